@@ -11,13 +11,18 @@ import (
 )
 
 type App struct {
-	DB         *pg.DB
-	ES         *elastic.Client
-	Redis      *redis.Client
-	Midtrans   *MidtransConfig
-	GoogleMaps *GoogleMapsConfig
-	Email      *EmailConfig
+	DB              *pg.DB
+	ES              *elastic.Client
+	Redis           *redis.Client
+	Midtrans        *MidtransConfig
+	GoogleMaps      *GoogleMapsConfig
+	Email           *EmailConfig
+	Cookie          *CookieConfig
+	PasswordPolicy  *PasswordPolicyConfig
+	FranchiseReview *FranchiseReviewConfig
+	WebsiteChecker  WebsiteChecker
 	Gemini		*genai.Client
+	TrustGeoHeaders bool // read the location our proxy adds to requests
 }
 
 type dbLogger struct{}
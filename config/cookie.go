@@ -0,0 +1,30 @@
+package config
+
+import (
+	"net/http"
+	"strings"
+)
+
+// CookieConfig holds the attributes of the auth cookies used by browser clients
+type CookieConfig struct {
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func NewCookieConfig() *CookieConfig {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(getEnvWithDefault("COOKIE_SAMESITE", "lax")) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+	return &CookieConfig{
+		Domain: getEnvWithDefault("COOKIE_DOMAIN", ""),
+		// Browsers accept Secure cookies on http://localhost, so it only has to be
+		// turned off when testing over plain HTTP on another host
+		Secure:   getEnvWithDefault("COOKIE_SECURE", "true") != "false",
+		SameSite: sameSite,
+	}
+}
@@ -11,6 +11,7 @@ type EmailConfig struct {
 	SMTPPassword string
 	FromEmail    string
 	FromName     string
+	AppBaseURL   string // frontend URL used to build links in emails
 }
 
 func NewEmailConfig() *EmailConfig {
@@ -21,6 +22,7 @@ func NewEmailConfig() *EmailConfig {
 		SMTPPassword: os.Getenv("SMTP_ACC_PASSWORD"),
 		FromEmail:    getEnvWithDefault("SMTP_ACC", ""),
 		FromName:     getEnvWithDefault("FROM_NAME", "Franchiso"),
+		AppBaseURL:   getEnvWithDefault("APP_BASE_URL", "http://localhost:3000"),
 	}
 }
 
@@ -0,0 +1,21 @@
+package config
+
+import (
+	"strings"
+)
+
+// FranchiseReviewConfig decides which edits to verified listings wait for a moderator
+type FranchiseReviewConfig struct {
+	// AutoApproveColumns are low-risk columns applied right away, every other column is reviewed
+	AutoApproveColumns map[string]bool
+}
+
+func NewFranchiseReviewConfig() *FranchiseReviewConfig {
+	columns := map[string]bool{}
+	for _, column := range strings.Split(getEnvWithDefault("FRANCHISE_AUTO_APPROVE_COLUMNS", ""), ",") {
+		if column = strings.TrimSpace(column); column != "" {
+			columns[column] = true
+		}
+	}
+	return &FranchiseReviewConfig{AutoApproveColumns: columns}
+}
@@ -0,0 +1,7 @@
+package config
+
+// TrustGeoHeaders reports whether TRUST_GEO_HEADERS=true. Only set it behind a proxy that
+// overwrites the location headers (Cloudflare or App Engine), otherwise clients can send their own.
+func TrustGeoHeaders() bool {
+	return getEnvWithDefault("TRUST_GEO_HEADERS", "false") == "true"
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"strconv"
+)
+
+// PasswordPolicyConfig is the password policy applied on registration and password changes
+type PasswordPolicyConfig struct {
+	MinLength    int
+	MaxLength    int
+	RejectCommon bool // check against the bundled list of common passwords
+}
+
+func NewPasswordPolicy() *PasswordPolicyConfig {
+	return &PasswordPolicyConfig{
+		MinLength:    getEnvInt("PASSWORD_MIN_LENGTH", 8),
+		MaxLength:    getEnvInt("PASSWORD_MAX_LENGTH", 128),
+		RejectCommon: getEnvWithDefault("PASSWORD_REJECT_COMMON", "true") != "false",
+	}
+}
+
+func getEnvInt(key string, defaultValue int) int {
+	value, err := strconv.Atoi(getEnvWithDefault(key, ""))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
@@ -0,0 +1,85 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// WebsiteChecker confirms that a franchise website can be reached.
+// It is pluggable so deployments without outbound access can swap or disable it.
+type WebsiteChecker interface {
+	CheckWebsite(ctx context.Context, url string) error
+}
+
+// HTTPWebsiteChecker requests the website and accepts any answer that is not a server error
+type HTTPWebsiteChecker struct {
+	Client *http.Client
+}
+
+// NewWebsiteChecker returns the checker chosen by WEBSITE_CHECK, "http" by default or "off".
+// Nil means websites are only checked for their syntax.
+func NewWebsiteChecker() WebsiteChecker {
+	if strings.EqualFold(getEnvWithDefault("WEBSITE_CHECK", "http"), "off") {
+		return nil
+	}
+	timeout := time.Duration(getEnvInt("WEBSITE_CHECK_TIMEOUT_SECONDS", 5)) * time.Second
+	return NewHTTPWebsiteChecker(timeout)
+}
+
+// NewHTTPWebsiteChecker returns a checker that refuses to connect to private addresses,
+// so a listing cannot make the server probe its own network
+func NewHTTPWebsiteChecker(timeout time.Duration) *HTTPWebsiteChecker {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() {
+				return errors.New("the website resolves to a private address")
+			}
+			return nil
+		},
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	return &HTTPWebsiteChecker{Client: &http.Client{Timeout: timeout, Transport: transport}}
+}
+
+func (checker *HTTPWebsiteChecker) CheckWebsite(ctx context.Context, url string) error {
+	status, err := checker.request(ctx, http.MethodHead, url)
+	if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+		// Some servers only answer GET
+		status, err = checker.request(ctx, http.MethodGet, url)
+	}
+	if err != nil {
+		return err
+	}
+	if status >= http.StatusInternalServerError {
+		return fmt.Errorf("the website answered with status %d", status)
+	}
+	return nil
+}
+
+func (checker *HTTPWebsiteChecker) request(ctx context.Context, method, url string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("User-Agent", "Franchiso website check")
+	resp, err := checker.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	seed := flag.Bool("seed", false, "seed the default roles and permissions")
+	email := flag.String("email", "", "email of the admin account to create")
+	name := flag.String("name", "", "name of the admin account")
+	password := flag.String("password", "", "password of the admin account")
+	role := flag.String("role", models.RoleSuperAdmin, "staff role: SuperAdmin, Moderator or Finance")
+	flag.Parse()
+
+	// Load environment variables
+	_ = godotenv.Load()
+
+	// Initialize database connection
+	db := config.NewPostgres()
+
+	if *seed {
+		if err := seedRolePermissions(db); err != nil {
+			log.Fatal("Error seeding roles and permissions:", err)
+		}
+		log.Println("Successfully seeded roles and permissions")
+	}
+
+	if *email == "" {
+		if !*seed {
+			flag.Usage()
+		}
+		return
+	}
+
+	if *name == "" || *password == "" {
+		log.Fatal("-name and -password are required to create an admin")
+	}
+	if !isStaffRole(*role) {
+		log.Fatalf("Invalid role %q, expected one of %v", *role, models.StaffRoles)
+	}
+	if fieldErrors := utils.CheckPasswordPolicy(config.NewPasswordPolicy(), "password", *password, *email, *name); len(fieldErrors) > 0 {
+		for _, fieldError := range fieldErrors {
+			log.Println(fieldError.Message)
+		}
+		log.Fatal("-password does not meet the password policy")
+	}
+
+	if err := createAdmin(db, *email, *name, *password, *role); err != nil {
+		log.Fatal("Error creating admin:", err)
+	}
+	log.Printf("Successfully created %s account for %s", *role, *email)
+}
+
+// seedRolePermissions inserts the default roles, permissions and grants.
+// Existing rows are left untouched so changes made through the admin API survive.
+func seedRolePermissions(db *pg.DB) error {
+	now := time.Now()
+	seenPermissions := map[string]bool{}
+
+	for roleName, permissions := range models.DefaultRolePermissions {
+		role := models.Role{
+			Name:      roleName,
+			IsPublic:  isPublicRole(roleName),
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if _, err := db.Model(&role).OnConflict("(name) DO NOTHING").Insert(); err != nil {
+			return err
+		}
+
+		for _, permissionName := range permissions {
+			if !seenPermissions[permissionName] {
+				permission := models.Permission{Name: permissionName, CreatedAt: now}
+				if _, err := db.Model(&permission).OnConflict("(name) DO NOTHING").Insert(); err != nil {
+					return err
+				}
+				seenPermissions[permissionName] = true
+			}
+
+			exists, err := db.Model((*models.RolePermission)(nil)).
+				Where("role = ? AND permission = ?", roleName, permissionName).
+				Exists()
+			if err != nil {
+				return err
+			}
+			if exists {
+				continue
+			}
+			rolePermission := models.RolePermission{Role: roleName, Permission: permissionName, CreatedAt: now}
+			if _, err := db.Model(&rolePermission).Insert(); err != nil {
+				return err
+			}
+		}
+		log.Printf("Seeded role %s with %d permissions", roleName, len(permissions))
+	}
+	return nil
+}
+
+func createAdmin(db *pg.DB, email, name, password, role string) error {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	user := models.User{
+		ID:           uuid.New(),
+		Name:         name,
+		Email:        email,
+		PasswordHash: hash,
+		Role:         role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	_, err = db.Model(&user).Insert()
+	return err
+}
+
+func isStaffRole(role string) bool {
+	for _, staffRole := range models.StaffRoles {
+		if role == staffRole {
+			return true
+		}
+	}
+	return false
+}
+
+func isPublicRole(role string) bool {
+	for _, publicRole := range models.PublicRoles {
+		if role == publicRole {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/service"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	sheet := flag.String("sheet", "", "CSV or XLSX sheet, one franchise per row")
+	images := flag.String("images", "", "ZIP with the files named in the sheet")
+	owner := flag.String("owner", "", "email of the franchisor the franchises belong to")
+	status := flag.String("status", "pending", "status of the imported franchises: draft or pending")
+	report := flag.String("report", "", "write the per-row report as JSON to this file")
+	flag.Parse()
+
+	if *sheet == "" || *owner == "" {
+		log.Fatal("Usage: import_franchises -sheet <file> -owner <email> [-images <zip>] [-status draft|pending] [-report <file>]")
+	}
+
+	// Load environment variables
+	err := godotenv.Load()
+	if err != nil {
+		panic("Error loading .env file")
+	}
+
+	// Initialize database connection
+	app := &config.App{
+		DB:             config.NewPostgres(),
+		WebsiteChecker: config.NewWebsiteChecker(),
+	}
+
+	job, err := importFranchises(app, *sheet, *images, *owner, *status)
+	if err != nil {
+		log.Fatal("Error importing franchises:", err)
+	}
+
+	if *report != "" {
+		data, _ := json.MarshalIndent(job, "", "  ")
+		if err := os.WriteFile(*report, data, 0o644); err != nil {
+			log.Fatal("Error writing report:", err)
+		}
+	}
+
+	if job.Error != "" {
+		log.Printf("Import stopped: %s", job.Error)
+	}
+	log.Printf("Imported %d of %d franchises, %d rows failed", job.Created, job.Total, job.Failed)
+}
+
+// importFranchises runs an import for the owner and logs the progress of every row
+func importFranchises(app *config.App, sheetPath, imagesPath, ownerEmail, status string) (*service.FranchiseImportJob, error) {
+	var owner models.User
+	if err := app.DB.Model(&owner).Where("email = ?", ownerEmail).Select(); err != nil {
+		return nil, err
+	}
+
+	sheetData, err := os.ReadFile(sheetPath)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := service.ReadFranchiseImportSheet(sheetPath, sheetData)
+	if err != nil {
+		return nil, err
+	}
+
+	var archiveData []byte
+	if imagesPath != "" {
+		archiveData, err = os.ReadFile(imagesPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+	images, err := service.ReadFranchiseImportImages(archiveData)
+	if err != nil {
+		return nil, err
+	}
+
+	job, err := service.NewFranchiseImportJob(owner.ID.String(), status, rows)
+	if err != nil {
+		return nil, err
+	}
+
+	service.RunFranchiseImport(context.Background(), app, job, rows, images, func(job *service.FranchiseImportJob) {
+		if len(job.Rows) == 0 || job.Status != service.FranchiseImportRunning {
+			return
+		}
+		row := job.Rows[len(job.Rows)-1]
+		if len(row.Errors) > 0 {
+			log.Printf("[%d/%d] Row %d (%s) failed:", job.Processed, job.Total, row.Row, row.Brand)
+			for _, fieldErr := range row.Errors {
+				log.Printf("    %s: %s", fieldErr.Field, fieldErr.Message)
+			}
+			return
+		}
+		log.Printf("[%d/%d] Row %d (%s) imported as %s", job.Processed, job.Total, row.Row, row.Brand, row.FranchiseID)
+	})
+	if job.Error != "" {
+		log.Printf("Import failed: %s", job.Error)
+	}
+	return job, nil
+}
@@ -4,7 +4,9 @@ package main
 import (
 	"github.com/chrisprojs/Franchiso/config"
 	"github.com/chrisprojs/Franchiso/middleware"
+	"github.com/chrisprojs/Franchiso/models"
 	"github.com/chrisprojs/Franchiso/service"
+	"github.com/chrisprojs/Franchiso/utils"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -16,6 +18,9 @@ type Server struct {
 }
 
 func NewServer() *Server {
+	if err := utils.LoadJWTKeys(); err != nil {
+		panic("Unable to load JWT keys: " + err.Error())
+	}
 	db := config.NewPostgres()
 	es := config.NewElastic()
 	redis := config.NewRedis()
@@ -23,12 +28,20 @@ func NewServer() *Server {
 	google_maps := config.NewGoogleMaps()
 	email := config.NewEmailConfig()
 	gemini := config.NewGemini()
-	app := &config.App{DB: db, ES: es, Redis: redis, Midtrans: midtrans, GoogleMaps: google_maps, Email: email, Gemini: gemini}
+	cookie := config.NewCookieConfig()
+	passwordPolicy := config.NewPasswordPolicy()
+	franchiseReview := config.NewFranchiseReviewConfig()
+	websiteChecker := config.NewWebsiteChecker()
+	trustGeoHeaders := config.TrustGeoHeaders()
+	app := &config.App{DB: db, ES: es, Redis: redis, Midtrans: midtrans, GoogleMaps: google_maps, Email: email, Cookie: cookie, PasswordPolicy: passwordPolicy, FranchiseReview: franchiseReview, WebsiteChecker: websiteChecker, Gemini: gemini, TrustGeoHeaders: trustGeoHeaders}
+	if err := service.EnsureFranchiseIndex(app); err != nil {
+		panic("Unable to prepare the franchises index: " + err.Error())
+	}
 	r := gin.Default()
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Auth-Mode", "X-CSRF-Token"},
 		AllowCredentials: true,
 	}))
 	return &Server{app: app, r: r}
@@ -40,6 +53,11 @@ func (s *Server) setupRoutes() {
 		c.JSON(200, gin.H{"status": "ok"})
 	})
 
+	// Public keys for verifying our JWTs
+	s.r.GET("/.well-known/jwks.json", func(c *gin.Context) {
+		service.JWKS(c)
+	})
+
 	// Auth routes group
 	s.r.POST("/register", func(c *gin.Context) {
 		service.Register(c, s.app)
@@ -47,55 +65,225 @@ func (s *Server) setupRoutes() {
 	s.r.POST("/verify-email", func(c *gin.Context) {
 		service.VerifyEmail(c, s.app)
 	})
+	s.r.POST("/verify-email/resend", func(c *gin.Context) {
+		service.ResendVerificationEmail(c, s.app)
+	})
+	s.r.POST("/verify-email/cancel", func(c *gin.Context) {
+		service.CancelRegistration(c, s.app)
+	})
 	s.r.POST("/login", func(c *gin.Context) {
 		service.Login(c, s.app)
 	})
+	s.r.POST("/login/email-link", func(c *gin.Context) {
+		service.RequestEmailLogin(c, s.app)
+	})
+	s.r.POST("/login/email-link/verify", func(c *gin.Context) {
+		service.VerifyEmailLogin(c, s.app)
+	})
+	s.r.POST("/login/mfa", middleware.MFAPendingMiddleware(s.app, func(c *gin.Context) {
+		service.VerifyMFALogin(c, s.app)
+	}))
+	s.r.POST("/login/mfa/enroll", middleware.MFAPendingMiddleware(s.app, func(c *gin.Context) {
+		service.EnrollMFA(c, s.app)
+	}))
+	s.r.POST("/login/mfa/enable", middleware.MFAPendingMiddleware(s.app, func(c *gin.Context) {
+		service.EnableMFA(c, s.app)
+	}))
+	s.r.POST("/forgot-password", func(c *gin.Context) {
+		service.ForgotPassword(c, s.app)
+	})
+	s.r.POST("/reset-password", func(c *gin.Context) {
+		service.ResetPassword(c, s.app)
+	})
 	s.r.GET("/profile", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
 		service.GetProfile(c, s.app)
 	}))
+	s.r.PUT("/profile", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.UpdateProfile(c, s.app)
+	}))
+	s.r.POST("/profile/password", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.ChangePassword(c, s.app)
+	}))
+	s.r.POST("/profile/email", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.ChangeEmail(c, s.app)
+	}))
+	s.r.POST("/profile/email/confirm", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.ConfirmEmailChange(c, s.app)
+	}))
+	s.r.GET("/profile/export", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.ExportPersonalData(c, s.app)
+	}))
+	s.r.DELETE("/profile", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.DeleteAccount(c, s.app)
+	}))
+	s.r.POST("/profile/restore", func(c *gin.Context) {
+		service.RestoreAccount(c, s.app)
+	})
+	s.r.POST("/auth/refresh", func(c *gin.Context) {
+		service.RefreshToken(c, s.app)
+	})
+	s.r.POST("/logout", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		service.Logout(c, s.app)
+	}))
+
+	// Session routes group
+	sessions := s.r.Group("/sessions")
+	{
+		sessions.GET("", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.ListSessions(c, s.app)
+		}))
+		sessions.DELETE("/:id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.RevokeSession(c, s.app)
+		}))
+		sessions.POST("/revoke-others", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.RevokeOtherSessions(c, s.app)
+		}))
+		sessions.POST("/report", func(c *gin.Context) {
+			service.ReportSession(c, s.app)
+		})
+	}
+
+	// API key routes group, keys can only be managed with a user session
+	apiKeys := s.r.Group("/api-keys")
+	{
+		apiKeys.GET("", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.ListAPIKeys(c, s.app)
+		}))
+		apiKeys.POST("", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.CreateAPIKey(c, s.app)
+		}))
+		apiKeys.DELETE("/:id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.RevokeAPIKey(c, s.app)
+		}))
+	}
+
+	// Two-factor authentication routes group
+	mfa := s.r.Group("/mfa")
+	{
+		mfa.POST("/enroll", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.EnrollMFA(c, s.app)
+		}))
+		mfa.POST("/enable", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.EnableMFA(c, s.app)
+		}))
+		mfa.POST("/disable", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.DisableMFA(c, s.app)
+		}))
+		mfa.POST("/recovery-codes", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.RegenerateRecoveryCodes(c, s.app)
+		}))
+	}
 
 	// Franchise routes group
 	franchise := s.r.Group("/franchise")
 	{
-		franchise.GET("/my_franchises", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		franchise.GET("/my_franchises", middleware.APIKeyOrAuthMiddleware(s.app, models.PermFranchiseManage, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
 			service.DisplayMyFranchises(c, s.app)
-		}))
-		franchise.POST("/upload", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		})))
+		franchise.POST("/upload", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
 			service.UploadFranchise(c, s.app)
-		}))
-		franchise.PUT("/edit/:id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		})))
+		franchise.PUT("/edit/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
 			service.EditFranchise(c, s.app)
+		})))
+		franchise.POST("/drafts", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.CreateDraftFranchise(c, s.app)
+		})))
+		franchise.GET("/drafts/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.GetDraftFranchise(c, s.app)
+		})))
+		franchise.PATCH("/drafts/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.PatchDraftFranchise(c, s.app)
+		})))
+		franchise.PUT("/drafts/:id/files/:field", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.UploadDraftFile(c, s.app)
+		})))
+		franchise.DELETE("/drafts/:id/files/:field", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.DeleteDraftFile(c, s.app)
+		})))
+		franchise.GET("/drafts/:id/completeness", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.DraftFranchiseCompleteness(c, s.app)
+		})))
+		franchise.POST("/drafts/:id/submit", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.SubmitDraftFranchise(c, s.app)
+		})))
+		franchise.GET("/:id/revisions", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.ListFranchiseRevisions(c, s.app)
 		}))
+		franchise.GET("/:id/revisions/:revision_id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.GetFranchiseRevision(c, s.app)
+		}))
+		franchise.GET("/:id/pending-changes", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+			service.GetPendingFranchiseChange(c, s.app)
+		}))
+		franchise.DELETE("/:id/pending-changes", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.WithdrawFranchiseChange(c, s.app)
+		})))
+		franchise.GET("/:id/outlets", func(c *gin.Context) {
+			showPrivate := c.DefaultQuery("showPrivate", "false")
+			if showPrivate == "true" {
+				middleware.APIKeyOrAuthMiddleware(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+					service.ListOutlets(c, s.app)
+				})(c)
+				return
+			}
+			middleware.OptionalAPIKeyMiddleware(s.app, models.ScopeFranchiseRead, func(c *gin.Context) {
+				service.ListOutlets(c, s.app)
+			})(c)
+		})
+		franchise.POST("/:id/outlets", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.CreateOutlet(c, s.app)
+		})))
+		franchise.PUT("/:id/outlets/:outlet_id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.UpdateOutlet(c, s.app)
+		})))
+		franchise.DELETE("/:id/outlets/:outlet_id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.DeleteOutlet(c, s.app)
+		})))
 		franchise.GET("/:id", func(c *gin.Context) {
 			showPrivate := c.DefaultQuery("showPrivate", "false")
 			if showPrivate == "true" {
-				middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+				middleware.APIKeyOrAuthMiddleware(s.app, models.PermFranchiseManage, func(c *gin.Context) {
 					service.DisplayFranchiseDetailByID(c, s.app)
 				})(c)
 				return
 			}
-			service.DisplayFranchiseDetailByID(c, s.app)
+			middleware.OptionalAPIKeyMiddleware(s.app, models.ScopeFranchiseRead, func(c *gin.Context) {
+				service.DisplayFranchiseDetailByID(c, s.app)
+			})(c)
 		})
-		franchise.DELETE("delete/:id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		franchise.DELETE("delete/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
 			service.DeleteFranchise(c, s.app)
-		}))
-		franchise.POST("", func(c *gin.Context) {
+		})))
+		franchise.POST("/import", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.ImportFranchises(c, s.app)
+		})))
+		franchise.GET("/import/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.GetFranchiseImport(c, s.app)
+		})))
+		franchise.GET("/archived", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.DisplayArchivedFranchises(c, s.app)
+		})))
+		franchise.POST("/:id/restore", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseManage, func(c *gin.Context) {
+			service.RestoreFranchise(c, s.app)
+		})))
+		franchise.POST("", middleware.OptionalAPIKeyMiddleware(s.app, models.ScopeFranchiseRead, func(c *gin.Context) {
 			service.SearchingFranchise(c, s.app)
-		})
-		franchise.GET("/categories", func(c *gin.Context) {
+		}))
+		franchise.GET("/categories", middleware.OptionalAPIKeyMiddleware(s.app, models.ScopeFranchiseRead, func(c *gin.Context) {
 			service.CategoryList(c, s.app)
-		})
-		franchise.GET("/locations", func(c *gin.Context) {
+		}))
+		franchise.GET("/locations", middleware.OptionalAPIKeyMiddleware(s.app, models.ScopeFranchiseRead, func(c *gin.Context) {
 			service.GetFranchiseLocations(c, s.app)
-		})
+		}))
 	}
 
 	// Boost routes group
 	boost := s.r.Group("/boost")
 	{
-		boost.POST("/:id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		boost.POST("/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseBoost, func(c *gin.Context) {
 			service.BoostFranchise(c, s.app)
-		}))
+		})))
 	}
 
 	// Mid trans callback routes group (generalized payment callback)
@@ -106,12 +294,48 @@ func (s *Server) setupRoutes() {
 	// Admin routes group
 	admin := s.r.Group("/admin")
 	{
-		admin.GET("/verify-franchise", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		admin.GET("/verify-franchise", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseVerify, func(c *gin.Context) {
 			service.DisplayAllRequestForVerificationFranchise(c, s.app)
-		}))
-		admin.PUT("/verify-franchise/:id", middleware.AuthMiddleware(s.app, func(c *gin.Context) {
+		})))
+		admin.PUT("/verify-franchise/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseVerify, func(c *gin.Context) {
 			service.VerifyFranchise(c, s.app)
-		}))
+		})))
+		admin.GET("/franchise-changes", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseVerify, func(c *gin.Context) {
+			service.DisplayFranchiseChangeRequests(c, s.app)
+		})))
+		admin.PUT("/franchise-changes/:id", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseVerify, func(c *gin.Context) {
+			service.ReviewFranchiseChange(c, s.app)
+		})))
+		admin.POST("/franchise/:id/revisions/:revision_id/restore", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermFranchiseVerify, func(c *gin.Context) {
+			service.RestoreFranchiseRevision(c, s.app)
+		})))
+		admin.GET("/payments", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermPaymentView, func(c *gin.Context) {
+			service.DisplayPayments(c, s.app)
+		})))
+		admin.POST("/invitations", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermUserInvite, func(c *gin.Context) {
+			service.CreateAdminInvitation(c, s.app)
+		})))
+		admin.POST("/invitations/accept", func(c *gin.Context) {
+			service.AcceptAdminInvitation(c, s.app)
+		})
+		admin.GET("/roles", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermRoleManage, func(c *gin.Context) {
+			service.ListRoles(c, s.app)
+		})))
+		admin.PUT("/roles/:role/permissions", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermRoleManage, func(c *gin.Context) {
+			service.UpdateRolePermissions(c, s.app)
+		})))
+		admin.GET("/mfa-policies", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermSecurityManage, func(c *gin.Context) {
+			service.ListMFAPolicies(c, s.app)
+		})))
+		admin.PUT("/mfa-policies/:role", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermSecurityManage, func(c *gin.Context) {
+			service.UpdateMFAPolicy(c, s.app)
+		})))
+		admin.GET("/lockouts", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermSecurityManage, func(c *gin.Context) {
+			service.ListLockouts(c, s.app)
+		})))
+		admin.DELETE("/lockouts/:email", middleware.AuthMiddleware(s.app, middleware.RequirePermission(s.app, models.PermSecurityManage, func(c *gin.Context) {
+			service.ClearLockout(c, s.app)
+		})))
 	}
 }
 
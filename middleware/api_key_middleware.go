@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"time"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	APIKeyHeader = "X-API-Key"
+
+	// last_used_at is written at most once per interval instead of on every request
+	apiKeyLastUsedInterval = time.Minute
+)
+
+// APIKeyOrAuthMiddleware accepts either an X-API-Key with the given scope or the usual
+// bearer access token. A key authenticates as its owner, so permission checks after it
+// still apply to the owner's role.
+func APIKeyOrAuthMiddleware(app *config.App, scope string, next gin.HandlerFunc) gin.HandlerFunc {
+	auth := AuthMiddleware(app, next)
+	return func(c *gin.Context) {
+		if c.GetHeader(APIKeyHeader) == "" {
+			auth(c)
+			return
+		}
+		if !authenticateAPIKey(c, app, scope) {
+			return
+		}
+		next(c)
+	}
+}
+
+// OptionalAPIKeyMiddleware is for public routes: requests without a key pass through,
+// requests with one are checked, counted against the key's quota and tracked.
+func OptionalAPIKeyMiddleware(app *config.App, scope string, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.GetHeader(APIKeyHeader) != "" && !authenticateAPIKey(c, app, scope) {
+			return
+		}
+		next(c)
+	}
+}
+
+func authenticateAPIKey(c *gin.Context, app *config.App, scope string) bool {
+	ctx := context.Background()
+
+	var key models.APIKey
+	err := app.DB.Model(&key).
+		Where("key_hash = ?", utils.HashToken(c.GetHeader(APIKeyHeader))).
+		Where("revoked_at IS NULL").
+		Select()
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return false
+	}
+	if !key.HasScope(scope) {
+		c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "API key does not have access"})
+		return false
+	}
+
+	// Keys stop working together with their owner's account
+	var owner models.User
+	err = app.DB.Model(&owner).Column("id", "role", "deletion_requested_at").Where("id = ?", key.UserID).Select()
+	if err != nil || owner.DeletionRequestedAt != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid API key"})
+		return false
+	}
+
+	used, resetIn, err := utils.IncrementDailyUsage(ctx, app.Redis, fmt.Sprintf("api_key_usage:%s", key.ID))
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return false
+	}
+	remaining := int64(key.DailyQuota) - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	c.Header("X-RateLimit-Limit", fmt.Sprintf("%d", key.DailyQuota))
+	c.Header("X-RateLimit-Remaining", fmt.Sprintf("%d", remaining))
+	if used > int64(key.DailyQuota) {
+		seconds := int(math.Ceil(resetIn.Seconds()))
+		c.Header("Retry-After", fmt.Sprintf("%d", seconds))
+		c.AbortWithStatusJSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Daily quota of this API key has been reached",
+			"retry_after": seconds,
+		})
+		return false
+	}
+
+	trackAPIKeyUsage(ctx, app, &key, c.ClientIP())
+
+	c.Set("user_id", key.UserID.String())
+	c.Set("role", owner.Role)
+	c.Set("api_key_id", key.ID.String())
+	return true
+}
+
+// trackAPIKeyUsage updates last_used_at and last_used_ip, throttled through Redis
+func trackAPIKeyUsage(ctx context.Context, app *config.App, key *models.APIKey, ip string) {
+	due, err := app.Redis.SetNX(ctx, fmt.Sprintf("api_key_last_used:%s", key.ID), ip, apiKeyLastUsedInterval).Result()
+	if err != nil || !due {
+		return
+	}
+	_, err = app.DB.Model((*models.APIKey)(nil)).
+		Set("last_used_at = ?", time.Now()).
+		Set("last_used_ip = ?", ip).
+		Where("id = ?", key.ID).
+		Update()
+	if err != nil {
+		fmt.Printf("Warning: Failed to track usage of API key %s: %v\n", key.ID, err)
+	}
+}
@@ -1,10 +1,12 @@
 package middleware
 
 import (
+	"context"
 	"net/http"
 	"strings"
-	"time"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/chrisprojs/Franchiso/config"
 	"github.com/chrisprojs/Franchiso/models"
@@ -13,66 +15,100 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+const sessionLastSeenInterval = time.Minute
+
 // Refactor: accepts next handler and app
 func AuthMiddleware(app *config.App, next gin.HandlerFunc) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// Mobile clients send a bearer header, browsers the access_token cookie
 		authHeader := c.GetHeader("Authorization")
-		if authHeader == "" {
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		fromCookie := authHeader == ""
+		if fromCookie {
+			tokenString, _ = c.Cookie(AccessTokenCookie)
+		}
+		if tokenString == "" {
 			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token not found"})
 			return
 		}
-		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
+		if fromCookie && !CheckCSRF(c) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+			return
+		}
+		ctx := context.Background()
 
 		claims, err := utils.ValidateJWT(tokenString, "access")
 		if err == nil {
-			// Token masih valid
-			c.Set("user_id", claims.UserID)
-			c.Set("role", claims.Role)
+			// Token masih valid, make sure it has not been signed out
+			if utils.IsTokenDenylisted(ctx, app.Redis, claims.ID) || utils.IsSessionRevoked(ctx, app.Redis, claims.SessionID) {
+				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token has been revoked"})
+				return
+			}
+			setAuthContext(c, claims)
+			touchSession(ctx, app, claims.SessionID)
 			next(c)
 			return
 		}
 
-		// If error is due to expiration, check refresh token
-		if !errors.Is(err, jwt.ErrTokenExpired) {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+		// Expired access tokens are no longer refreshed here, clients exchange
+		// their refresh token explicitly through POST /auth/refresh
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
 			return
 		}
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+	}
+}
 
-		// Get refresh token from cookie
-		refreshToken, err := c.Cookie("refresh_token")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Refresh token not found"})
-			return
-		}
+// setAuthContext exposes the authenticated token to the handlers
+func setAuthContext(c *gin.Context, claims *utils.JWTClaims) {
+	c.Set("user_id", claims.UserID)
+	c.Set("role", claims.Role)
+	c.Set("session_id", claims.SessionID)
+	c.Set("token_id", claims.ID)
+	if claims.ExpiresAt != nil {
+		c.Set("token_expires_at", claims.ExpiresAt.Time)
+	}
+}
 
-		refreshClaims, err := utils.ValidateJWT(refreshToken, "refresh")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+// touchSession updates the session's last_seen_at, at most once a minute
+func touchSession(ctx context.Context, app *config.App, sessionID string) {
+	due, err := app.Redis.SetNX(ctx, fmt.Sprintf("session_seen:%s", sessionID), 1, sessionLastSeenInterval).Result()
+	if err != nil || !due {
+		return
+	}
+	_, err = app.DB.Model((*models.Session)(nil)).
+		Set("last_seen_at = ?", time.Now()).
+		Where("id = ?", sessionID).
+		Update()
+	if err != nil {
+		fmt.Printf("Warning: Failed to update last seen of session %s: %v\n", sessionID, err)
+	}
+}
+
+// MFAPendingMiddleware authenticates the second login step with the short-lived
+// mfa_pending token that Login returns when two-factor authentication applies
+func MFAPendingMiddleware(app *config.App, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		if authHeader == "" {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Token not found"})
 			return
 		}
+		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		// Check refresh token in sessions table
-		var session models.Session
-		err = app.DB.Model(&session).
-			Where("refresh_token = ? AND user_id = ?", refreshToken, refreshClaims.UserID).
-			Where("expires_at > ?", time.Now()).
-			Select()
+		claims, err := utils.ValidateJWT(tokenString, "mfa_pending")
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired two-factor token. Please login again"})
 			return
 		}
-
-		// Generate new access token
-		newAccessToken, err := utils.GenerateJWT(refreshClaims.UserID, refreshClaims.Role, "access")
-		if err != nil {
-			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate access token"})
+		if utils.IsTokenDenylisted(context.Background(), app.Redis, claims.ID) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Two-factor token has already been used. Please login again"})
 			return
 		}
 
-		// Send new access token to client (can be via header or response body)
-		c.Header("X-New-Access-Token", newAccessToken)
-		c.Set("user_id", refreshClaims.UserID)
-		c.Set("role", refreshClaims.Role)
+		setAuthContext(c, claims)
+		c.Set("mfa_pending", true)
 		next(c)
 	}
 }
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/gin-gonic/gin"
+)
+
+const rolePermissionsCacheTTL = 5 * time.Minute
+
+// RequirePermission only lets the request through when the role set by AuthMiddleware
+// has been granted the permission in franchiso.role_permissions
+func RequirePermission(app *config.App, permission string, next gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !HasPermission(app, c.GetString("role"), permission) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "User does not have access"})
+			return
+		}
+		next(c)
+	}
+}
+
+// HasPermission checks the role's permissions, cached in Redis for a few minutes
+func HasPermission(app *config.App, role string, permission string) bool {
+	if role == "" {
+		return false
+	}
+
+	ctx := context.Background()
+	cacheKey := fmt.Sprintf("role_permissions:%s", role)
+
+	cached, err := app.Redis.Exists(ctx, cacheKey).Result()
+	if err == nil && cached > 0 {
+		isMember, err := app.Redis.SIsMember(ctx, cacheKey, permission).Result()
+		return err == nil && isMember
+	}
+
+	var rolePermissions []models.RolePermission
+	err = app.DB.Model(&rolePermissions).Where("role = ?", role).Select()
+	if err != nil {
+		fmt.Printf("Warning: Failed to load permissions of role %s: %v\n", role, err)
+		return false
+	}
+
+	// An empty placeholder member keeps roles without permissions cached as well
+	members := []interface{}{""}
+	allowed := false
+	for _, rp := range rolePermissions {
+		members = append(members, rp.Permission)
+		if rp.Permission == permission {
+			allowed = true
+		}
+	}
+	pipe := app.Redis.TxPipeline()
+	pipe.Del(ctx, cacheKey)
+	pipe.SAdd(ctx, cacheKey, members...)
+	pipe.Expire(ctx, cacheKey, rolePermissionsCacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Warning: Failed to cache permissions of role %s: %v\n", role, err)
+	}
+
+	return allowed
+}
+
+// InvalidateRolePermissions drops the cached permissions after they are changed
+func InvalidateRolePermissions(app *config.App, role string) {
+	app.Redis.Del(context.Background(), fmt.Sprintf("role_permissions:%s", role))
+}
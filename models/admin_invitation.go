@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type AdminInvitation struct {
+	tableName  struct{}   `pg:"franchiso.admin_invitations"`
+	ID         uuid.UUID  `pg:"id" json:"id"`
+	Email      string     `pg:"email" json:"email"`
+	Role       string     `pg:"role" json:"role"`
+	TokenHash  string     `pg:"token_hash" json:"-"`
+	InvitedBy  uuid.UUID  `pg:"invited_by" json:"invited_by"`
+	ExpiresAt  time.Time  `pg:"expires_at" json:"expires_at"`
+	AcceptedAt *time.Time `pg:"accepted_at" json:"accepted_at"`
+	CreatedAt  time.Time  `pg:"created_at" json:"created_at"`
+}
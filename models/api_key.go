@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// API key scopes. Besides ScopeFranchiseRead a key can be given permissions of its
+// owner's role, e.g. PermFranchiseManage to read the owner's own listings.
+const (
+	ScopeFranchiseRead = "franchise:read" // search, detail, categories and locations
+)
+
+// APIKeyScopes are the scopes a key can be created with
+var APIKeyScopes = []string{ScopeFranchiseRead, PermFranchiseManage}
+
+// APIKey lets partner systems call the API without a user session.
+// Only the hash of the key is stored, Prefix is kept to recognize it in listings.
+type APIKey struct {
+	tableName  struct{}   `pg:"franchiso.api_keys"`
+	ID         uuid.UUID  `pg:"id" json:"id"`
+	UserID     uuid.UUID  `pg:"user_id" json:"user_id"`
+	Name       string     `pg:"name" json:"name"`
+	Prefix     string     `pg:"prefix" json:"prefix"`
+	KeyHash    string     `pg:"key_hash" json:"-"`
+	Scopes     []string   `pg:"scopes,array" json:"scopes"`
+	DailyQuota int        `pg:"daily_quota" json:"daily_quota"` // requests per UTC day
+	LastUsedAt *time.Time `pg:"last_used_at" json:"last_used_at"`
+	LastUsedIP string     `pg:"last_used_ip" json:"last_used_ip"`
+	RevokedAt  *time.Time `pg:"revoked_at" json:"revoked_at"`
+	CreatedAt  time.Time  `pg:"created_at" json:"created_at"`
+}
+
+// HasScope reports whether the key was granted the scope
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -6,6 +6,14 @@ import (
 	"github.com/google/uuid"
 )
 
+// Franchise statuses
+const (
+	FranchiseStatusDraft    = "Draft"               // being filled in, only visible to its owner
+	FranchiseStatusPending  = "Menunggu Verifikasi" // submitted, waiting for a moderator
+	FranchiseStatusVerified = "Terverifikasi"
+	FranchiseStatusRejected = "Ditolak"
+)
+
 type Franchise struct {
 	tableName       struct{}  `pg:"franchiso.franchises"`
 	ID              uuid.UUID `pg:"id" json:"id"`
@@ -30,28 +38,35 @@ type Franchise struct {
 	CreatedAt       time.Time `pg:"created_at" json:"created_at"`
 	UpdatedAt       time.Time `pg:"updated_at" json:"updated_at"`
 
-	User     *User     `pg:"rel:has-one,fk:user_id" json:"user"`
-	Category *Category `pg:"rel:has-one,fk:category_id" json:"category"`
+	// Set while the franchise is archived. Queries skip archived rows unless they ask for
+	// them with Deleted or AllWithDeleted, Delete archives and ForceDelete removes the row.
+	DeletedAt *time.Time `pg:"deleted_at,soft_delete" json:"deleted_at,omitempty"`
+
+	User     *User              `pg:"rel:has-one,fk:user_id" json:"user"`
+	Category *Category          `pg:"rel:has-one,fk:category_id" json:"category"`
+	Packages []FranchisePackage `pg:"rel:has-many,join_fk:franchise_id" json:"packages"`
 }
 
 type FranchiseES struct {
-	ID              string            `json:"id"`
-	User            UserES            `json:"user"`
-	Category        CategoryES        `json:"category"`
-	Brand           string            `json:"brand"`
-	Logo            VectorizedImage   `json:"logo"`
-	AdPhotos        []VectorizedImage `json:"ad_photos"`
-	Description     string            `json:"description"`
-	Investment      int               `json:"investment"`
-	MonthlyRevenue  int               `json:"monthly_revenue"`
-	ROI             int               `json:"roi"`
-	BranchCount     int               `json:"branch_count"`
-	YearFounded     int               `json:"year_founded"`
-	Website         string            `json:"website"`
-	WhatsappContact string            `json:"whatsapp_contact"`
-	IsBoosted       bool              `json:"is_boosted"`
-	CreatedAt       string            `json:"created_at"`
-	UpdatedAt       string            `json:"updated_at"`
+	ID              string               `json:"id"`
+	User            UserES               `json:"user"`
+	Category        CategoryES           `json:"category"`
+	Brand           string               `json:"brand"`
+	Logo            VectorizedImage      `json:"logo"`
+	AdPhotos        []VectorizedImage    `json:"ad_photos"`
+	Description     string               `json:"description"`
+	Investment      int                  `json:"investment"`
+	MonthlyRevenue  int                  `json:"monthly_revenue"`
+	ROI             int                  `json:"roi"`
+	BranchCount     int                  `json:"branch_count"`
+	YearFounded     int                  `json:"year_founded"`
+	Website         string               `json:"website"`
+	WhatsappContact string               `json:"whatsapp_contact"`
+	IsBoosted       bool                 `json:"is_boosted"`
+	Packages        []FranchisePackageES `json:"packages"`
+	Outlets         []OutletES           `json:"outlets"`
+	CreatedAt       string               `json:"created_at"`
+	UpdatedAt       string               `json:"updated_at"`
 }
 
 type UserES struct {
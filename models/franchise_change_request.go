@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Change request statuses
+const (
+	ChangeRequestPending  = "pending"
+	ChangeRequestApproved = "approved"
+	ChangeRequestRejected = "rejected"
+)
+
+// FranchiseChangeRequest holds edits to a verified franchise until a moderator reviews
+// them, the live listing and its search document stay as they are until approval.
+// A franchise has at most one pending request, later edits are merged into it. The table
+// enforces this with a partial unique index:
+//
+//	CREATE UNIQUE INDEX franchise_change_requests_one_pending
+//	    ON franchiso.franchise_change_requests (franchise_id) WHERE status = 'pending';
+type FranchiseChangeRequest struct {
+	tableName   struct{}               `pg:"franchiso.franchise_change_requests"`
+	ID          uuid.UUID              `pg:"id" json:"id"`
+	FranchiseID uuid.UUID              `pg:"franchise_id" json:"franchise_id"`
+	UserID      uuid.UUID              `pg:"user_id" json:"user_id"` // the franchisor who made the edits
+	Columns     []string               `pg:"columns,array" json:"columns"`
+	Changes     map[string]FieldChange `pg:"changes,type:jsonb" json:"changes"`
+	Proposed    *Franchise             `pg:"proposed,type:jsonb" json:"proposed,omitempty"` // the franchise with the changes applied
+	Status      string                 `pg:"status" json:"status"`
+	ReviewedBy  *uuid.UUID             `pg:"reviewed_by,type:uuid" json:"reviewed_by"`
+	ReviewNote  string                 `pg:"review_note" json:"review_note"`
+	ReviewedAt  *time.Time             `pg:"reviewed_at" json:"reviewed_at"`
+	CreatedAt   time.Time              `pg:"created_at" json:"created_at"`
+	UpdatedAt   time.Time              `pg:"updated_at" json:"updated_at"`
+
+	Franchise *Franchise `pg:"rel:has-one,fk:franchise_id" json:"franchise,omitempty"`
+}
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"github.com/google/uuid"
+)
+
+// FranchisePackage is one format a franchise is offered in, e.g. booth, kiosk or restaurant.
+// The Investment, MonthlyRevenue and ROI of the franchise itself stay the headline figures.
+type FranchisePackage struct {
+	tableName      struct{}  `pg:"franchiso.franchise_packages"`
+	ID             uuid.UUID `pg:"id" json:"id"`
+	FranchiseID    uuid.UUID `pg:"franchise_id" json:"franchise_id"`
+	Name           string    `pg:"name" json:"name"`
+	Investment     int       `pg:"investment,use_zero" json:"investment"`
+	FranchiseFee   int       `pg:"franchise_fee,use_zero" json:"franchise_fee"`     // one-off fee, included in Investment
+	RoyaltyFee     float64   `pg:"royalty_fee,use_zero" json:"royalty_fee"`         // percent of monthly revenue
+	MinArea        int       `pg:"min_area,use_zero" json:"min_area"`               // square meters
+	MonthlyRevenue int       `pg:"monthly_revenue,use_zero" json:"monthly_revenue"` // estimate
+	ROI            int       `pg:"roi,use_zero" json:"roi"`
+	Position       int       `pg:"position,use_zero" json:"position"` // order within the franchise
+}
+
+type FranchisePackageES struct {
+	Name           string  `json:"name"`
+	Investment     int     `json:"investment"`
+	FranchiseFee   int     `json:"franchise_fee"`
+	RoyaltyFee     float64 `json:"royalty_fee"`
+	MinArea        int     `json:"min_area"`
+	MonthlyRevenue int     `json:"monthly_revenue"`
+	ROI            int     `json:"roi"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Revision actions
+const (
+	RevisionActionCreate  = "create"  // uploaded or started as a draft
+	RevisionActionEdit    = "edit"    // changed by the owner
+	RevisionActionSubmit  = "submit"  // draft sent to the verification queue
+	RevisionActionReview  = "review"  // status set by a moderator
+	RevisionActionRestore = "restore" // an earlier revision was restored
+	RevisionActionApprove = "approve" // a pending change request was approved
+)
+
+// FieldChange is the value of one column before and after a revision
+type FieldChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// FranchiseRevision is one change to a franchise. Changes holds only the columns that
+// changed, keyed by column name, Snapshot the whole franchise after the change.
+type FranchiseRevision struct {
+	tableName    struct{}               `pg:"franchiso.franchise_revisions"`
+	ID           uuid.UUID              `pg:"id" json:"id"`
+	FranchiseID  uuid.UUID              `pg:"franchise_id" json:"franchise_id"`
+	AuthorID     uuid.UUID              `pg:"author_id" json:"author_id"`
+	Action       string                 `pg:"action" json:"action"`
+	Changes      map[string]FieldChange `pg:"changes,type:jsonb" json:"changes"`
+	Snapshot     *Franchise             `pg:"snapshot,type:jsonb" json:"snapshot,omitempty"`
+	RestoredFrom *uuid.UUID             `pg:"restored_from,type:uuid" json:"restored_from,omitempty"` // set for RevisionActionRestore
+	CreatedAt    time.Time              `pg:"created_at" json:"created_at"`
+}
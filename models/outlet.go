@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Outlet types
+const (
+	OutletTypeCompanyOwned = "company_owned" // run by the franchisor
+	OutletTypeFranchised   = "franchised"    // run by a franchisee
+)
+
+// Outlet is a registered location of a franchise, maintained by the franchisor
+type Outlet struct {
+	tableName   struct{}   `pg:"franchiso.outlets"`
+	ID          uuid.UUID  `pg:"id" json:"id"`
+	FranchiseID uuid.UUID  `pg:"franchise_id" json:"franchise_id"`
+	Name        string     `pg:"name" json:"name"`
+	Address     string     `pg:"address" json:"address"`
+	Latitude    float64    `pg:"latitude,use_zero" json:"latitude"`
+	Longitude   float64    `pg:"longitude,use_zero" json:"longitude"`
+	Province    string     `pg:"province" json:"province"` // name as in indonesia-province-simple.json
+	Type        string     `pg:"type" json:"type"`
+	OpenedAt    *time.Time `pg:"opened_at,type:date" json:"opened_at"`
+	CreatedAt   time.Time  `pg:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `pg:"updated_at" json:"updated_at"`
+}
+
+type OutletES struct {
+	ID       string     `json:"id"`
+	Name     string     `json:"name"`
+	Province string     `json:"province"`
+	Type     string     `json:"type"`
+	Location GeoPointES `json:"location"`
+}
+
+// GeoPointES is a geo_point field of the search documents
+type GeoPointES struct {
+	Lat float64 `json:"lat"`
+	Lon float64 `json:"lon"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+)
+
+// Roles
+const (
+	RoleSuperAdmin = "SuperAdmin"
+	RoleModerator  = "Moderator"
+	RoleFinance    = "Finance"
+	RoleFranchisor = "Franchisor"
+	RoleFranchisee = "Franchisee"
+
+	// RoleAdmin is the role of admin accounts created before the permission model,
+	// it keeps the same permissions as RoleSuperAdmin
+	RoleAdmin = "Admin"
+)
+
+// Permissions
+const (
+	PermFranchiseManage      = "franchise:manage"       // upload, edit and delete own listings
+	PermFranchiseBoost       = "franchise:boost"        // buy boosts for own listings
+	PermFranchiseVerify      = "franchise:verify"       // review the verification queue
+	PermFranchiseViewPrivate = "franchise:view_private" // see private data of any listing
+	PermPaymentView          = "payment:view"
+	PermUserInvite           = "user:invite"
+	PermRoleManage           = "role:manage"
+	PermSecurityManage       = "security:manage" // two-factor policies and lockouts
+)
+
+// PublicRoles are the only roles that can be chosen on self-registration,
+// staff accounts are created by invitation or with the create_admin CLI
+var PublicRoles = []string{RoleFranchisor, RoleFranchisee}
+
+// StaffRoles can only be granted through an admin invitation
+var StaffRoles = []string{RoleSuperAdmin, RoleModerator, RoleFinance}
+
+// DefaultRolePermissions is the initial permission set seeded into Postgres
+var DefaultRolePermissions = map[string][]string{
+	RoleSuperAdmin: {PermFranchiseVerify, PermFranchiseViewPrivate, PermPaymentView, PermUserInvite, PermRoleManage, PermSecurityManage},
+	RoleAdmin:      {PermFranchiseVerify, PermFranchiseViewPrivate, PermPaymentView, PermUserInvite, PermRoleManage, PermSecurityManage},
+	RoleModerator:  {PermFranchiseVerify, PermFranchiseViewPrivate},
+	RoleFinance:    {PermPaymentView},
+	RoleFranchisor: {PermFranchiseManage, PermFranchiseBoost},
+	RoleFranchisee: {},
+}
+
+type Role struct {
+	tableName struct{}  `pg:"franchiso.roles"`
+	Name      string    `pg:"name,pk" json:"name"`
+	IsPublic  bool      `pg:"is_public,use_zero" json:"is_public"`
+	CreatedAt time.Time `pg:"created_at" json:"created_at"`
+	UpdatedAt time.Time `pg:"updated_at" json:"updated_at"`
+}
+
+type Permission struct {
+	tableName struct{}  `pg:"franchiso.permissions"`
+	Name      string    `pg:"name,pk" json:"name"`
+	CreatedAt time.Time `pg:"created_at" json:"created_at"`
+}
+
+type RolePermission struct {
+	tableName  struct{}  `pg:"franchiso.role_permissions"`
+	Role       string    `pg:"role" json:"role"`
+	Permission string    `pg:"permission" json:"permission"`
+	CreatedAt  time.Time `pg:"created_at" json:"created_at"`
+}
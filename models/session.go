@@ -7,11 +7,19 @@ import (
 )
 
 type Session struct {
-	tableName    struct{}  `pg:"franchiso.sessions"`
-	ID           uuid.UUID `pg:"id" json:"id"`
-	UserID       uuid.UUID `pg:"user_id" json:"user_id"`
-	RefreshToken string    `pg:"refresh_token" json:"refresh_token"`
-	ExpiresAt    time.Time `pg:"expires_at" json:"expires_at"`
-	CreatedAt    time.Time `pg:"created_at" json:"created_at"`
-	UpdatedAt    time.Time `pg:"updated_at" json:"updated_at"`
+	tableName    struct{}   `pg:"franchiso.sessions"`
+	ID           uuid.UUID  `pg:"id" json:"id"`
+	UserID       uuid.UUID  `pg:"user_id" json:"user_id"`
+	RefreshToken string     `pg:"refresh_token" json:"-"`
+	FamilyID     uuid.UUID  `pg:"family_id" json:"family_id"` // first session of the rotation chain
+	ParentID     *uuid.UUID `pg:"parent_id" json:"parent_id"` // session whose refresh token was rotated into this one
+	RotatedAt    *time.Time `pg:"rotated_at" json:"rotated_at"`
+	UserAgent    string     `pg:"user_agent" json:"user_agent"`
+	IP           string     `pg:"ip" json:"ip"`
+	Country      string     `pg:"country" json:"country"` // approximate location from the proxy's geo headers, empty when unknown
+	City         string     `pg:"city" json:"city"`
+	LastSeenAt   time.Time  `pg:"last_seen_at" json:"last_seen_at"`
+	ExpiresAt    time.Time  `pg:"expires_at" json:"expires_at"`
+	CreatedAt    time.Time  `pg:"created_at" json:"created_at"`
+	UpdatedAt    time.Time  `pg:"updated_at" json:"updated_at"`
 }
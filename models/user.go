@@ -14,4 +14,7 @@ type User struct {
 	Role         string    `pg:"role" json:"role"`
 	CreatedAt    time.Time `pg:"created_at" json:"created_at"`
 	UpdatedAt    time.Time `pg:"updated_at" json:"updated_at"`
+
+	// Set when the owner asked for account deletion, the account is purged after the grace period
+	DeletionRequestedAt *time.Time `pg:"deletion_requested_at" json:"deletion_requested_at,omitempty"`
 } 
\ No newline at end of file
@@ -0,0 +1,27 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type UserMFA struct {
+	tableName          struct{}   `pg:"franchiso.user_mfa"`
+	UserID             uuid.UUID  `pg:"user_id,pk" json:"user_id"`
+	Secret             string     `pg:"secret" json:"-"`
+	Enabled            bool       `pg:"enabled,use_zero" json:"enabled"`
+	RecoveryCodeHashes []string   `pg:"recovery_code_hashes,array" json:"-"`
+	EnabledAt          *time.Time `pg:"enabled_at" json:"enabled_at"`
+	CreatedAt          time.Time  `pg:"created_at" json:"created_at"`
+	UpdatedAt          time.Time  `pg:"updated_at" json:"updated_at"`
+}
+
+// MFARolePolicy makes two-factor authentication mandatory for every user of a role
+type MFARolePolicy struct {
+	tableName struct{}  `pg:"franchiso.mfa_role_policies"`
+	Role      string    `pg:"role,pk" json:"role"`
+	Required  bool      `pg:"required,use_zero" json:"required"`
+	UpdatedBy uuid.UUID `pg:"updated_by" json:"updated_by"`
+	UpdatedAt time.Time `pg:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/service"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only list the franchises that would be purged")
+	flag.Parse()
+
+	// Load environment variables
+	err := godotenv.Load()
+	if err != nil {
+		panic("Error loading .env file")
+	}
+
+	// Initialize database connections
+	app := &config.App{
+		DB: config.NewPostgres(),
+		ES: config.NewElastic(),
+	}
+
+	if err := purgeArchivedFranchises(app, *dryRun); err != nil {
+		log.Fatal("Error purging archived franchises:", err)
+	}
+
+	log.Println("Successfully purged archived franchises")
+}
+
+// purgeArchivedFranchises permanently removes franchises whose retention period has passed
+func purgeArchivedFranchises(app *config.App, dryRun bool) error {
+	cutoff := time.Now().Add(-service.FranchiseRetentionPeriod)
+
+	var franchises []models.Franchise
+	err := app.DB.Model(&franchises).
+		Where("deleted_at < ?", cutoff).
+		Deleted().
+		Select()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Found %d franchises past the retention period", len(franchises))
+
+	for i := range franchises {
+		franchise := &franchises[i]
+		if dryRun {
+			log.Printf("Would purge franchise %s (archived at %s)", franchise.ID, franchise.DeletedAt.Format(time.RFC3339))
+			continue
+		}
+
+		if err := service.PurgeFranchise(context.Background(), app, franchise); err != nil {
+			log.Printf("Error purging franchise %s: %v", franchise.ID, err)
+			continue
+		}
+
+		log.Printf("Successfully purged franchise %s", franchise.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/service"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only list the accounts that would be purged")
+	flag.Parse()
+
+	// Load environment variables
+	err := godotenv.Load()
+	if err != nil {
+		panic("Error loading .env file")
+	}
+
+	// Initialize database connections
+	app := &config.App{
+		DB: config.NewPostgres(),
+		ES: config.NewElastic(),
+	}
+
+	if err := purgeDeletedAccounts(app, *dryRun); err != nil {
+		log.Fatal("Error purging deleted accounts:", err)
+	}
+
+	log.Println("Successfully purged deleted accounts")
+}
+
+// purgeDeletedAccounts permanently removes accounts whose deletion grace period has passed
+func purgeDeletedAccounts(app *config.App, dryRun bool) error {
+	cutoff := time.Now().Add(-service.AccountDeletionGracePeriod)
+
+	var users []models.User
+	err := app.DB.Model(&users).
+		Where("deletion_requested_at IS NOT NULL AND deletion_requested_at < ?", cutoff).
+		Select()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Found %d accounts past the deletion grace period", len(users))
+
+	for _, user := range users {
+		if dryRun {
+			log.Printf("Would purge user %s (deletion requested at %s)", user.ID, user.DeletionRequestedAt.Format(time.RFC3339))
+			continue
+		}
+
+		if err := service.PurgeUser(context.Background(), app, user.ID.String()); err != nil {
+			log.Printf("Error purging user %s: %v", user.ID, err)
+			continue
+		}
+
+		log.Printf("Successfully purged user %s", user.ID)
+	}
+
+	return nil
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/service"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Load environment variables
+	err := godotenv.Load()
+	if err != nil {
+		panic("Error loading .env file")
+	}
+
+	// Initialize database connection
+	app := &config.App{
+		DB: config.NewPostgres(),
+	}
+
+	purged, err := service.PurgeExpiredSessions(context.Background(), app)
+	if err != nil {
+		log.Fatal("Error purging expired sessions:", err)
+	}
+
+	log.Printf("Successfully purged %d expired sessions", purged)
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/service"
+	"github.com/chrisprojs/Franchiso/utils"
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only list the files that would be deleted")
+	grace := flag.Duration("grace", 24*time.Hour, "keep unreferenced files younger than this, they may belong to an upload in progress")
+	flag.Parse()
+
+	// Load environment variables
+	err := godotenv.Load()
+	if err != nil {
+		panic("Error loading .env file")
+	}
+
+	// Initialize database connection
+	app := &config.App{
+		DB: config.NewPostgres(),
+	}
+
+	if err := purgeOrphanedUploads(app, *grace, *dryRun); err != nil {
+		log.Fatal("Error purging orphaned uploads:", err)
+	}
+
+	log.Println("Successfully purged orphaned uploads")
+}
+
+// purgeOrphanedUploads deletes the stored files that no franchise, revision or change request
+// refers to and that are older than the grace period
+func purgeOrphanedUploads(app *config.App, grace time.Duration, dryRun bool) error {
+	cutoff := time.Now().Add(-grace)
+
+	// List the files before collecting the references, a file uploaded in between is younger
+	// than the grace period
+	files, err := utils.ListStorageProxyFiles()
+	if err != nil {
+		return err
+	}
+	referenced, err := service.ReferencedUploadFiles(context.Background(), app)
+	if err != nil {
+		return err
+	}
+
+	var orphaned, recent, failed int
+	var freed int64
+	for _, file := range files {
+		if referenced[utils.StorageFileName(file.FileUrl)] {
+			continue
+		}
+		if file.ModifiedAt.After(cutoff) {
+			recent++
+			continue
+		}
+
+		orphaned++
+		if dryRun {
+			log.Printf("Would delete %s (%d bytes, modified at %s)", file.FileUrl, file.Size, file.ModifiedAt.Format(time.RFC3339))
+			continue
+		}
+
+		if err := utils.DeleteFromStorageProxy(file.FileUrl); err != nil {
+			log.Printf("Error deleting %s: %v", file.FileUrl, err)
+			failed++
+			continue
+		}
+		freed += file.Size
+	}
+
+	log.Printf("Found %d files, %d referenced, %d orphaned, %d unreferenced but within the grace period",
+		len(files), len(files)-orphaned-recent, orphaned, recent)
+	if !dryRun {
+		log.Printf("Deleted %d files (%d bytes), %d failed", orphaned-failed, freed, failed)
+	}
+
+	return nil
+}
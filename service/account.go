@@ -0,0 +1,274 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// AccountDeletionGracePeriod is how long a deleted account can still be restored
+// before purge_deleted_accounts removes it for good
+const AccountDeletionGracePeriod = 30 * 24 * time.Hour
+
+type DeleteAccountRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+type RestoreAccountRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+// PersonalDataExport is everything stored about a user, grouped the same way as the ZIP files
+type PersonalDataExport struct {
+	ExportedAt time.Time          `json:"exported_at"`
+	User       models.User        `json:"user"`
+	Sessions   []models.Session   `json:"sessions"`
+	APIKeys    []models.APIKey    `json:"api_keys"`
+	Franchises []models.Franchise `json:"franchises"`
+	Boosts     []models.Boost     `json:"boosts"`
+	Payments   []models.Payment   `json:"payments"`
+}
+
+// ExportPersonalData returns the user's data as a ZIP of JSON files, or as one JSON document with ?format=json
+func ExportPersonalData(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+
+	export, err := collectPersonalData(app, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to collect personal data: %v", err)})
+		return
+	}
+
+	if c.Query("format") == "json" {
+		c.JSON(http.StatusOK, export)
+		return
+	}
+
+	files := map[string]interface{}{
+		"user.json":       export.User,
+		"sessions.json":   export.Sessions,
+		"api_keys.json":   export.APIKeys,
+		"franchises.json": export.Franchises,
+		"boosts.json":     export.Boosts,
+		"payments.json":   export.Payments,
+	}
+
+	buf := new(bytes.Buffer)
+	zipWriter := zip.NewWriter(buf)
+	for _, name := range []string{"user.json", "sessions.json", "api_keys.json", "franchises.json", "boosts.json", "payments.json"} {
+		content, err := json.MarshalIndent(files[name], "", "  ")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to encode personal data"})
+			return
+		}
+		w, err := zipWriter.Create(name)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export archive"})
+			return
+		}
+		w.Write(content)
+	}
+	if err := zipWriter.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create export archive"})
+		return
+	}
+
+	filename := fmt.Sprintf("franchiso-data-%s.zip", export.ExportedAt.Format("20060102"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "application/zip", buf.Bytes())
+}
+
+func collectPersonalData(app *config.App, userID string) (*PersonalDataExport, error) {
+	export := &PersonalDataExport{
+		ExportedAt: time.Now(),
+		Sessions:   []models.Session{},
+		APIKeys:    []models.APIKey{},
+		Franchises: []models.Franchise{},
+		Boosts:     []models.Boost{},
+		Payments:   []models.Payment{},
+	}
+
+	if err := app.DB.Model(&export.User).Where("id = ?", userID).Select(); err != nil {
+		return nil, err
+	}
+	err := app.DB.Model(&export.Sessions).Where("user_id = ?", userID).Order("created_at ASC").Select()
+	if err != nil {
+		return nil, err
+	}
+	err = app.DB.Model(&export.APIKeys).Where("user_id = ?", userID).Order("created_at ASC").Select()
+	if err != nil {
+		return nil, err
+	}
+	err = app.DB.Model(&export.Franchises).
+		Relation("Packages", orderPackages).
+		Where("franchise.user_id = ?", userID).
+		AllWithDeleted().
+		Order("franchise.created_at ASC").
+		Select()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(export.Franchises) == 0 {
+		return export, nil
+	}
+	franchiseIDs := make([]uuid.UUID, len(export.Franchises))
+	for i, franchise := range export.Franchises {
+		franchiseIDs[i] = franchise.ID
+	}
+	err = app.DB.Model(&export.Boosts).Where("franchise_id IN (?)", pg.In(franchiseIDs)).Order("created_at ASC").Select()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(export.Boosts) == 0 {
+		return export, nil
+	}
+	boostIDs := make([]uuid.UUID, len(export.Boosts))
+	for i, boost := range export.Boosts {
+		boostIDs[i] = boost.ID
+	}
+	err = app.DB.Model(&export.Payments).Where("boost_id IN (?)", pg.In(boostIDs)).Order("created_at ASC").Select()
+	if err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// DeleteAccount schedules the account for deletion. It is signed out and hidden from search
+// immediately, and purged for good after the grace period unless it is restored.
+func DeleteAccount(c *gin.Context, app *config.App) {
+	var req DeleteAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if ok, _, _ := utils.VerifyPassword(user.PasswordHash, req.Password); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	now := time.Now()
+	_, err = app.DB.Model((*models.User)(nil)).
+		Set("deletion_requested_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("id = ?", userID).
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+		return
+	}
+
+	// Remove the listings from search right away, they come back if the account is restored
+	var franchises []models.Franchise
+	err = app.DB.Model(&franchises).
+		Column("id").
+		Where("user_id = ?", userID).
+		Where("status = ?", models.FranchiseStatusVerified).
+		Select()
+	if err != nil {
+		fmt.Printf("Warning: Failed to get franchises of user %s: %v\n", userID, err)
+	}
+	for _, franchise := range franchises {
+		if err := deleteFranchiseFromES(app, franchise.ID.String()); err != nil {
+			fmt.Printf("Warning: Failed to delete franchise %s from Elasticsearch: %v\n", franchise.ID, err)
+		}
+	}
+
+	ctx := context.Background()
+	if _, err := revokeUserSessions(ctx, app, userID, ""); err != nil {
+		fmt.Printf("Warning: Failed to revoke sessions of user %s: %v\n", userID, err)
+	}
+	if expiresAt, ok := c.Get("token_expires_at"); ok {
+		utils.DenylistToken(ctx, app.Redis, c.GetString("token_id"), expiresAt.(time.Time))
+	}
+
+	clearAuthCookies(c, app)
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Account has been scheduled for deletion",
+		"permanent_from": now.Add(AccountDeletionGracePeriod),
+	})
+}
+
+// RestoreAccount cancels a scheduled deletion during the grace period
+func RestoreAccount(c *gin.Context, app *config.App) {
+	var req RestoreAccountRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkAuthThrottle(c, app, loginThrottle, req.Email) {
+		return
+	}
+
+	var user models.User
+	err := app.DB.Model(&user).Where("email = ?", req.Email).Select()
+	if err != nil {
+		recordAuthFailure(c, app, loginThrottle, req.Email, "")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
+		return
+	}
+	if ok, _, _ := utils.VerifyPassword(user.PasswordHash, req.Password); !ok {
+		recordAuthFailure(c, app, loginThrottle, req.Email, user.Name)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
+		return
+	}
+	clearAuthFailures(app, loginThrottle, req.Email)
+
+	if user.DeletionRequestedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account is not scheduled for deletion"})
+		return
+	}
+
+	_, err = app.DB.Model((*models.User)(nil)).
+		Set("deletion_requested_at = NULL").
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", user.ID).
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore account"})
+		return
+	}
+
+	var franchises []models.Franchise
+	err = app.DB.Model(&franchises).
+		Relation("User").
+		Relation("Category").
+		Where("franchise.user_id = ?", user.ID).
+		Where("franchise.status = ?", models.FranchiseStatusVerified).
+		Select()
+	if err != nil {
+		fmt.Printf("Warning: Failed to get franchises of user %s: %v\n", user.ID, err)
+	}
+	for i := range franchises {
+		if err := indexFranchiseToES(app, &franchises[i]); err != nil {
+			fmt.Printf("Warning: Failed to restore franchise %s in Elasticsearch: %v\n", franchises[i].ID, err)
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Account has been restored. Please login"})
+}
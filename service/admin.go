@@ -4,11 +4,12 @@ import (
 	"context"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/chrisprojs/Franchiso/config"
 	"github.com/chrisprojs/Franchiso/models"
-	"github.com/chrisprojs/Franchiso/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
 )
 
 type DisplayAllRequestForVerificationFranchiseResponse struct {
@@ -17,15 +18,9 @@ type DisplayAllRequestForVerificationFranchiseResponse struct {
 
 // DisplayAllRequestForVerificationFranchise displays all franchises with status 'Waiting for Verification'
 func DisplayAllRequestForVerificationFranchise(c *gin.Context, app *config.App) {
-	role := c.GetString("role")
-	if role != "Admin" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User does not have access"})
-		return
-	}
-
 	var franchises []models.Franchise
 	err := app.DB.Model(&franchises).
-		Where("status = ?", "Menunggu Verifikasi").
+		Where("status = ?", models.FranchiseStatusPending).
 		Select()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch franchise data: " + err.Error()})
@@ -49,106 +44,67 @@ func VerifyFranchise(c *gin.Context, app *config.App) {
 		return
 	}
 
-	role := c.GetString("role")
-	if role != "Admin" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User does not have access"})
-		return
-	}
-
-	// Update franchise status
 	var franchise models.Franchise
-	_, err := app.DB.Model(&franchise).
-		Where("id = ?", id).
-		Set("status = ?", req.Status).
-		Update()
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to update franchise: %v", err)})
-		return
-	}
-
-	// Query ulang franchise beserta relasinya
-	err = app.DB.Model(&franchise).
+	err := app.DB.Model(&franchise).
 		Relation("User").
 		Relation("Category").
+		Relation("Packages", orderPackages).
 		Where("franchise.id = ?", id).
 		Select()
-	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Gagal mengambil data franchise: %v", err)})
+	// Drafts are not submitted yet, so they cannot be reviewed
+	if err != nil || franchise.Status == models.FranchiseStatusDraft {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
 		return
 	}
+	before := franchise
 
-	// If verified, sync to ES
-	if req.Status == "Terverifikasi" {
-		var user models.User
-		if franchise.User != nil {
-			user = *franchise.User
-		}
-
-		var category models.Category
-		if franchise.Category != nil {
-			category = *franchise.Category
-		}
-
-		// Convert logo and ad_photos to VectorizedImage structure
-		logoVectorized, err := utils.ConvertToVectorizedImage(franchise.Logo)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		adPhotosVectorized, err := utils.ConvertToVectorizedImages(franchise.AdPhotos)
+	// Update franchise status
+	franchise.Status = req.Status
+	franchise.UpdatedAt = time.Now()
+	err = app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		res, err := tx.Model(&franchise).
+			Column("status", "updated_at").
+			WherePK().
+			Where("status <> ?", models.FranchiseStatusDraft).
+			Update()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
+			return err
 		}
-
-		// Convert ad_photos to []map[string]interface{} to ensure object structure in Elasticsearch
-		adPhotosMaps := make([]map[string]interface{}, len(adPhotosVectorized))
-		for i, img := range adPhotosVectorized {
-			adPhotosMaps[i] = map[string]interface{}{
-				"file_path": img.FilePath,
-				"vector":    img.Vector,
-			}
+		if res.RowsAffected() == 0 {
+			return pg.ErrNoRows
 		}
+		return recordFranchiseRevision(tx, &before, &franchise, c.GetString("user_id"), models.RevisionActionReview, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("Failed to update franchise: %v", err)})
+		return
+	}
 
-		// Prepare data according to mapping
-		doc := map[string]interface{}{
-			"id": franchise.ID.String(),
-			"user": map[string]interface{}{
-				"user_id": franchise.UserID.String(),
-				"name":    user.Name,
-			},
-			"category": map[string]interface{}{
-				"category_id": franchise.CategoryID.String(),
-				"category":    category.Category,
-			},
-			"brand": franchise.Brand,
-			"logo": map[string]interface{}{
-				"file_path": logoVectorized.FilePath,
-				"vector":    logoVectorized.Vector,
-			},
-			"ad_photos":        adPhotosMaps,
-			"description":      franchise.Description,
-			"investment":       franchise.Investment,
-			"monthly_revenue":  franchise.MonthlyRevenue,
-			"roi":              franchise.ROI,
-			"branch_count":     franchise.BranchCount,
-			"year_founded":     franchise.YearFounded,
-			"website":          franchise.Website,
-			"whatsapp_contact": franchise.WhatsappContact,
-			"is_boosted":       franchise.IsBoosted,
-			"created_at":       franchise.CreatedAt,
-			"updated_at":       franchise.UpdatedAt,
-		}
-		_, err = app.ES.Index().
-			Index("franchises").
-			Id(franchise.ID.String()).
-			BodyJson(doc).
-			Do(context.Background())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to synchronize to Elasticsearch"})
+	// If verified, sync to ES
+	if req.Status == models.FranchiseStatusVerified {
+		if err := indexFranchiseToES(app, &franchise); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Franchise status updated successfully"})
 }
+
+type DisplayPaymentsResponse struct {
+	Payments []models.Payment `json:"payments"`
+}
+
+// DisplayPayments displays the recorded Midtrans payments, newest first
+func DisplayPayments(c *gin.Context, app *config.App) {
+	var payments []models.Payment
+	err := app.DB.Model(&payments).
+		Relation("Boost").
+		Order("payment.transaction_time DESC").
+		Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch payment data: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, DisplayPaymentsResponse{Payments: payments})
+}
@@ -0,0 +1,169 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/middleware"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const (
+	apiKeyDefaultDailyQuota = 1000
+	apiKeyMaxDailyQuota     = 10000
+	apiKeyMaxPerUser        = 10
+	apiKeyPrefixLength      = 8
+)
+
+type CreateAPIKeyRequest struct {
+	Name       string   `json:"name" binding:"required"`
+	Scopes     []string `json:"scopes"`
+	DailyQuota int      `json:"daily_quota"`
+}
+
+type CreateAPIKeyResponse struct {
+	APIKey models.APIKey `json:"api_key"`
+	Key    string        `json:"key"` // only returned once
+}
+
+type ListAPIKeysResponse struct {
+	APIKeys []models.APIKey `json:"api_keys"`
+}
+
+// CreateAPIKey creates a key for partner systems. Keys only get franchise:read unless
+// other scopes are asked for, and those have to be permissions of the user's role.
+func CreateAPIKey(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	var req CreateAPIKeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	scopes := []string{models.ScopeFranchiseRead}
+	for _, scope := range req.Scopes {
+		if !isAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Unknown scope: %s", scope)})
+			return
+		}
+		if scope == models.ScopeFranchiseRead || containsString(scopes, scope) {
+			continue
+		}
+		if !middleware.HasPermission(app, c.GetString("role"), scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": fmt.Sprintf("User cannot grant scope: %s", scope)})
+			return
+		}
+		scopes = append(scopes, scope)
+	}
+
+	dailyQuota := req.DailyQuota
+	if dailyQuota == 0 {
+		dailyQuota = apiKeyDefaultDailyQuota
+	}
+	if dailyQuota < 0 || dailyQuota > apiKeyMaxDailyQuota {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("daily_quota must be between 1 and %d", apiKeyMaxDailyQuota)})
+		return
+	}
+
+	active, err := app.DB.Model((*models.APIKey)(nil)).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Count()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+	if active >= apiKeyMaxPerUser {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A user can have at most %d active API keys", apiKeyMaxPerUser)})
+		return
+	}
+
+	secret, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	rawKey := "fk_" + secret
+
+	key := models.APIKey{
+		ID:         uuid.New(),
+		UserID:     uuid.MustParse(userID),
+		Name:       req.Name,
+		Prefix:     rawKey[:len("fk_")+apiKeyPrefixLength],
+		KeyHash:    utils.HashToken(rawKey),
+		Scopes:     scopes,
+		DailyQuota: dailyQuota,
+		CreatedAt:  time.Now(),
+	}
+	if _, err := app.DB.Model(&key).Insert(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create API key"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, CreateAPIKeyResponse{APIKey: key, Key: rawKey})
+}
+
+// ListAPIKeys lists the keys of the current user, revoked ones included
+func ListAPIKeys(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	keys := []models.APIKey{}
+	err := app.DB.Model(&keys).Where("user_id = ?", userID).Order("created_at DESC").Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch API keys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, ListAPIKeysResponse{APIKeys: keys})
+}
+
+// RevokeAPIKey disables one of the current user's keys immediately
+func RevokeAPIKey(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	keyID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid API key id"})
+		return
+	}
+
+	res, err := app.DB.Model((*models.APIKey)(nil)).
+		Set("revoked_at = ?", time.Now()).
+		Where("id = ?", keyID).
+		Where("user_id = ?", userID).
+		Where("revoked_at IS NULL").
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke API key"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "API key not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "API key revoked successfully"})
+}
+
+func isAPIKeyScope(scope string) bool {
+	return containsString(models.APIKeyScopes, scope)
+}
@@ -9,7 +9,6 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/chrisprojs/Franchiso/config"
 	"github.com/chrisprojs/Franchiso/models"
@@ -20,7 +19,7 @@ type RegisterRequest struct {
 	Name     string `json:"name" binding:"required"`
 	Email    string `json:"email" binding:"required,email"`
 	Password string `json:"password" binding:"required"`
-	Role     string `json:"role" binding:"required"`
+	Role     string `json:"role" binding:"required,oneof=Franchisor Franchisee"` // staff roles are invitation-only
 }
 
 type RegisterResponse struct {
@@ -34,9 +33,11 @@ type LoginRequest struct {
 	Password string `json:"password" binding:"required"`
 }
 
+// LoginResponse carries the tokens in the body, or only the CSRF token in browser mode
 type LoginResponse struct {
-	AccessToken  string       `json:"access_token"`
-	RefreshToken string       `json:"refresh_token"`
+	AccessToken  string       `json:"access_token,omitempty"`
+	RefreshToken string       `json:"refresh_token,omitempty"`
+	CSRFToken    string       `json:"csrf_token,omitempty"`
 	User         UserResponse `json:"user"`
 }
 
@@ -65,6 +66,20 @@ type VerifyEmailResponse struct {
 	User         UserResponse `json:"user"`
 }
 
+type ResendVerificationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type CancelRegistrationRequest struct {
+	Email    string `json:"email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+const (
+	verificationResendCooldown = time.Minute
+	verificationResendDailyCap = 5
+)
+
 type PendingUserData struct {
 	ID           string `json:"id"`
 	Name         string `json:"name"`
@@ -89,16 +104,11 @@ func Register(c *gin.Context, app *config.App) {
 		return
 	}
 
-	// Check if email already exists in Redis (pending verification)
-	ctx := context.Background()
-	pendingKey := fmt.Sprintf("pending_registration:%s", req.Email)
-	exists, err := app.Redis.Exists(ctx, pendingKey).Result()
-	if err == nil && exists > 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is in the verification process. Please check your email or wait a moment"})
+	if rejectWeakPassword(c, app, "password", req.Password, req.Email, req.Name) {
 		return
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hash, err := utils.HashPassword(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to hash password: %v", err)})
 		return
@@ -117,7 +127,7 @@ func Register(c *gin.Context, app *config.App) {
 		ID:           userID.String(),
 		Name:         req.Name,
 		Email:        req.Email,
-		PasswordHash: string(hash),
+		PasswordHash: hash,
 		Role:         req.Role,
 		Code:         verificationCode,
 	}
@@ -128,18 +138,15 @@ func Register(c *gin.Context, app *config.App) {
 		return
 	}
 
-	// Save data with key: pending_registration:{email}
-	err = app.Redis.Set(ctx, pendingKey, string(userDataJSON), 10*time.Minute).Err()
+	// Save data with key: pending_registration:{email} and an attempt counter of 0, unless
+	// another registration for the email is pending; of two parallel requests only one wins
+	created, err := createPendingRegistration(context.Background(), app.Redis, req.Email, string(userDataJSON), pendingRegistrationTTL)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store registration data"})
 		return
 	}
-
-	// Initialize attempt counter to 0
-	attemptKey := fmt.Sprintf("verification_attempt:%s", req.Email)
-	err = app.Redis.Set(ctx, attemptKey, "0", 10*time.Minute).Err()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize verification system"})
+	if !created {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is in the verification process. Please check your email, request a new code or cancel the pending registration"})
 		return
 	}
 
@@ -149,15 +156,13 @@ func Register(c *gin.Context, app *config.App) {
 		// Log the error but do not fail registration, because the data is already stored in Redis
 		// The user can still try to verify using the generated code
 		fmt.Printf("Warning: Failed to send verification email to %s: %v\n", req.Email, err)
-		// Optionally delete data from Redis if you want to cancel the process when email fails to send
-		// app.Redis.Del(ctx, pendingKey)
-		// app.Redis.Del(ctx, attemptKey)
 		// c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration succeeded but failed to send verification email. Please contact the administrator."})
 		// return
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"message": "Registration successful. Please check your email for the verification code",
+		"message":    "Registration successful. Please check your email for the verification code",
+		"email_sent": err == nil, // when false the client can offer POST /verify-email/resend
 	})
 }
 
@@ -168,50 +173,40 @@ func VerifyEmail(c *gin.Context, app *config.App) {
 		return
 	}
 
-	ctx := context.Background()
-	pendingKey := fmt.Sprintf("pending_registration:%s", req.Email)
-	attemptKey := fmt.Sprintf("verification_attempt:%s", req.Email)
-
-	// Check whether registration data exists in Redis
-	pendingData, err := app.Redis.Get(ctx, pendingKey).Result()
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification code is invalid or has expired. Please register again"})
+	if !checkAuthThrottle(c, app, verifyEmailThrottle, req.Email) {
 		return
 	}
 
-	// Check attempt counter
-	attemptStr, err := app.Redis.Get(ctx, attemptKey).Result()
+	// Checking the code, counting a wrong one and consuming the registration is one atomic step
+	ctx := context.Background()
+	result, err := consumeVerificationCode(ctx, app.Redis, req.Email, req.VerificationCode)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read attempt data"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read registration data"})
 		return
 	}
 
-	var attemptCount int
-	fmt.Sscanf(attemptStr, "%d", &attemptCount)
-	if attemptCount >= 3 {
-		// Delete data from Redis because verification has failed 3 times
-		app.Redis.Del(ctx, pendingKey)
-		app.Redis.Del(ctx, attemptKey)
+	switch result.Status {
+	case verificationMissing:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification code is invalid or has expired. Please register again"})
+		return
+	case verificationExhausted:
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification attempts have reached the maximum limit (3 times). Please register again"})
 		return
 	}
 
 	// Parse user data from Redis
 	var pendingUser PendingUserData
-	if err := json.Unmarshal([]byte(pendingData), &pendingUser); err != nil {
+	if err := json.Unmarshal([]byte(result.Data), &pendingUser); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal membaca data registrasi"})
 		return
 	}
 
-	// Verify code
-	if pendingUser.Code != req.VerificationCode {
-		// Increment attempt counter
-		attemptCount++
-		app.Redis.Set(ctx, attemptKey, fmt.Sprintf("%d", attemptCount), 10*time.Minute)
-		remainingAttempts := 3 - attemptCount
+	if result.Status == verificationMismatch {
+		// Also counted per email across registrations, registering again does not reset it
+		recordAuthFailure(c, app, verifyEmailThrottle, req.Email, pendingUser.Name)
 		c.JSON(http.StatusBadRequest, gin.H{
 			"error":              "Incorrect verification code",
-			"remaining_attempts": remainingAttempts,
+			"remaining_attempts": result.RemainingAttempts,
 		})
 		return
 	}
@@ -233,114 +228,233 @@ func VerifyEmail(c *gin.Context, app *config.App) {
 		UpdatedAt:    time.Now(),
 	}
 
-	_, err = app.DB.Model(&user).Insert()
+	// The ID comes from the registration, so inserting it again is a no-op instead of a second account
+	res, err := app.DB.Model(&user).OnConflict("DO NOTHING").Insert()
 	if err != nil {
+		// Put the registration back so the code can be tried again
+		if _, restoreErr := createPendingRegistration(ctx, app.Redis, req.Email, result.Data, result.TTL); restoreErr != nil {
+			fmt.Printf("Warning: Failed to restore pending registration of %s: %v\n", req.Email, restoreErr)
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save user: %v", err)})
 		return
 	}
+	if res.RowsAffected() == 0 {
+		// Either this registration was already saved, or the email was taken in the meantime
+		exists, err := app.DB.Model((*models.User)(nil)).Where("id = ?", userID).Exists()
+		if err != nil || !exists {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already registered"})
+			return
+		}
+	}
+
+	clearAuthFailures(app, verifyEmailThrottle, req.Email)
+
+	// Issue the session, or ask for the second factor when the role requires it
+	completeLogin(c, app, &user)
+}
+
+// ResendVerificationEmail issues a new code for a pending registration and resets its attempt counter
+func ResendVerificationEmail(c *gin.Context, app *config.App) {
+	var req ResendVerificationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	pendingKey := pendingRegistrationKey(req.Email)
+	cooldownKey := fmt.Sprintf("verification_resend_cooldown:%s", req.Email)
+	resendCountKey := fmt.Sprintf("verification_resend_count:%s", req.Email)
 
-	// Generate JWT token after verification is successful
-	accessToken, err := utils.GenerateJWT(user.ID.String(), user.Role, "access")
+	pendingData, err := app.Redis.Get(ctx, pendingKey).Result()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate access token: %v", err)})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending registration found. Please register again"})
 		return
 	}
-	refreshToken, err := utils.GenerateJWT(user.ID.String(), user.Role, "refresh")
+
+	// One resend per minute
+	ok, err := app.Redis.SetNX(ctx, cooldownKey, "1", verificationResendCooldown).Result()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate refresh token: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process resend request"})
+		return
+	}
+	if !ok {
+		retryAfter, _ := app.Redis.TTL(ctx, cooldownKey).Result()
+		c.JSON(http.StatusTooManyRequests, gin.H{
+			"error":       "Please wait before requesting another verification code",
+			"retry_after": int(retryAfter.Seconds()),
+		})
 		return
 	}
 
-	// Save refresh token to sessions table
-	session := models.Session{
-		ID:           uuid.New(),
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+	// At most verificationResendDailyCap resends per email per day
+	resendCount, err := app.Redis.Incr(ctx, resendCountKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process resend request"})
+		return
+	}
+	if resendCount == 1 {
+		app.Redis.Expire(ctx, resendCountKey, 24*time.Hour)
 	}
-	_, err = app.DB.Model(&session).Insert()
+	if resendCount > verificationResendDailyCap {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Verification code resend limit reached for today. Please try again tomorrow"})
+		return
+	}
+
+	var pendingUser PendingUserData
+	if err := json.Unmarshal([]byte(pendingData), &pendingUser); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read registration data"})
+		return
+	}
+
+	verificationCode, err := utils.GenerateVerificationCode()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification code"})
 		return
 	}
+	pendingUser.Code = verificationCode
 
-	// Delete data from Redis because verification has succeeded
-	app.Redis.Del(ctx, pendingKey)
-	app.Redis.Del(ctx, attemptKey)
+	userDataJSON, err := json.Marshal(pendingUser)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare registration data"})
+		return
+	}
 
-	resp := VerifyEmailResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User: UserResponse{
-			ID:    user.ID.String(),
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  user.Role,
-		},
+	// The new code gets a fresh 10 minute window and attempt counter, unless the
+	// registration has been verified or cancelled in the meantime
+	replaced, err := replacePendingRegistration(ctx, app.Redis, req.Email, string(userDataJSON))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store registration data"})
+		return
 	}
-	c.JSON(http.StatusOK, resp)
+	if !replaced {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending registration found. Please register again"})
+		return
+	}
+
+	err = SendVerificationEmail(app.Email, pendingUser.Email, pendingUser.Name, verificationCode)
+	if err != nil {
+		// Give the attempt back so the user can retry right away
+		app.Redis.Del(ctx, cooldownKey)
+		app.Redis.Decr(ctx, resendCountKey)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email. Please try again"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":           "A new verification code has been sent to your email",
+		"remaining_resends": verificationResendDailyCap - int(resendCount),
+	})
 }
 
-func Login(c *gin.Context, app *config.App) {
-	var req LoginRequest
+// CancelRegistration discards a pending registration so the email can be registered again right away
+func CancelRegistration(c *gin.Context, app *config.App) {
+	var req CancelRegistrationRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	var user models.User
-	err := app.DB.Model(&user).Where("email = ?", req.Email).Select()
+	ctx := context.Background()
+	pendingData, err := app.Redis.Get(ctx, pendingRegistrationKey(req.Email)).Result()
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No pending registration found"})
+		return
+	}
+
+	var pendingUser PendingUserData
+	if err := json.Unmarshal([]byte(pendingData), &pendingUser); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read registration data"})
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(req.Password)); err != nil {
+	// Only the person who registered knows the password, so nobody else can cancel it
+	if ok, _, _ := utils.VerifyPassword(pendingUser.PasswordHash, req.Password); !ok {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
 		return
 	}
 
-	// Generate JWT token after user successfully logged in
-	accessToken, err := utils.GenerateJWT(user.ID.String(), user.Role, "access")
+	// Only delete the registration that was checked, not one replaced in the meantime
+	deleted, err := deletePendingRegistration(ctx, app.Redis, req.Email, pendingData)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate access token: %v", err)})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel registration"})
 		return
 	}
-	refreshToken, err := utils.GenerateJWT(user.ID.String(), user.Role, "refresh")
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate refresh token: %v", err)})
+	if !deleted {
+		c.JSON(http.StatusConflict, gin.H{"error": "Pending registration has changed. Please try again"})
 		return
 	}
 
-	// Save refresh token to sessions table
-	session := models.Session{
-		ID:           uuid.New(),
-		UserID:       user.ID,
-		RefreshToken: refreshToken,
-		ExpiresAt:    time.Now().Add(7 * 24 * time.Hour),
-		CreatedAt:    time.Now(),
-		UpdatedAt:    time.Now(),
+	c.JSON(http.StatusOK, gin.H{"message": "Pending registration has been cancelled"})
+}
+
+func Login(c *gin.Context, app *config.App) {
+	var req LoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkAuthThrottle(c, app, loginThrottle, req.Email) {
+		return
 	}
-	_, err = app.DB.Model(&session).Insert()
+
+	var user models.User
+	err := app.DB.Model(&user).Where("email = ?", req.Email).Select()
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		// Unknown emails are counted too, so lockouts do not reveal which accounts exist
+		recordAuthFailure(c, app, loginThrottle, req.Email, "")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
+		return
+	}
+
+	ok, needsRehash, _ := utils.VerifyPassword(user.PasswordHash, req.Password)
+	if !ok {
+		recordAuthFailure(c, app, loginThrottle, req.Email, user.Name)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Email or password is incorrect"})
 		return
 	}
+	clearAuthFailures(app, loginThrottle, req.Email)
+	if needsRehash {
+		upgradePasswordHash(app, &user, req.Password)
+	}
 
-	resp := LoginResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-		User: UserResponse{
-			ID:    user.ID.String(),
-			Name:  user.Name,
-			Email: user.Email,
-			Role:  user.Role,
-		},
+	// Issue the session, or ask for the second factor when two-factor authentication applies
+	completeLogin(c, app, &user)
+}
+
+// upgradePasswordHash replaces a hash of an older algorithm, or with weaker parameters,
+// while the plain password is at hand after a successful login
+func upgradePasswordHash(app *config.App, user *models.User, password string) {
+	hash, err := utils.HashPassword(password)
+	if err != nil {
+		fmt.Printf("Warning: Failed to rehash password of user %s: %v\n", user.ID, err)
+		return
 	}
+	// Only replace the hash that was verified, a concurrent password change wins
+	_, err = app.DB.Model((*models.User)(nil)).
+		Set("password_hash = ?", hash).
+		Where("id = ?", user.ID).
+		Where("password_hash = ?", user.PasswordHash).
+		Update()
+	if err != nil {
+		fmt.Printf("Warning: Failed to store rehashed password of user %s: %v\n", user.ID, err)
+		return
+	}
+	user.PasswordHash = hash
+}
 
-	c.JSON(http.StatusOK, resp)
+// rejectWeakPassword answers with the broken password policy rules as field errors
+func rejectWeakPassword(c *gin.Context, app *config.App, field, password, email, name string) bool {
+	fieldErrors := utils.CheckPasswordPolicy(app.PasswordPolicy, field, password, email, name)
+	if len(fieldErrors) == 0 {
+		return false
+	}
+	c.JSON(http.StatusBadRequest, gin.H{
+		"error":  "Password does not meet the requirements",
+		"fields": fieldErrors,
+	})
+	return true
 }
 
 func GetProfile(c *gin.Context, app *config.App) {
@@ -0,0 +1,68 @@
+package service
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/middleware"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// authModeHeader lets browser clients ask for cookies instead of tokens in the body
+const authModeHeader = "X-Auth-Mode"
+
+// refreshCookiePath keeps the refresh token from being sent with any other request
+const refreshCookiePath = "/auth/refresh"
+
+type sessionTokens struct {
+	AccessToken  string
+	RefreshToken string
+	CSRFToken    string
+}
+
+// isBrowserMode reports whether the client sent X-Auth-Mode: cookie
+func isBrowserMode(c *gin.Context) bool {
+	return strings.EqualFold(c.GetHeader(authModeHeader), "cookie")
+}
+
+// deliverTokens hands a new token pair to the client. In browser mode the tokens are set as
+// HttpOnly cookies with a fresh CSRF token, and only the CSRF token is returned for the body.
+// Otherwise the tokens go in the body as before.
+func deliverTokens(c *gin.Context, app *config.App, browser bool, accessToken, refreshToken string) (sessionTokens, error) {
+	if !browser {
+		return sessionTokens{AccessToken: accessToken, RefreshToken: refreshToken}, nil
+	}
+
+	csrfToken, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	setAuthCookie(c, app, middleware.AccessTokenCookie, accessToken, "/", int(utils.AccessTokenTTL.Seconds()), true)
+	setAuthCookie(c, app, middleware.RefreshTokenCookie, refreshToken, refreshCookiePath, int(utils.RefreshTokenTTL.Seconds()), true)
+	// Readable by the frontend, which repeats it in the X-CSRF-Token header
+	setAuthCookie(c, app, middleware.CSRFCookie, csrfToken, "/", int(utils.RefreshTokenTTL.Seconds()), false)
+	return sessionTokens{CSRFToken: csrfToken}, nil
+}
+
+// clearAuthCookies removes the browser mode cookies, e.g. on logout
+func clearAuthCookies(c *gin.Context, app *config.App) {
+	setAuthCookie(c, app, middleware.AccessTokenCookie, "", "/", -1, true)
+	setAuthCookie(c, app, middleware.RefreshTokenCookie, "", refreshCookiePath, -1, true)
+	setAuthCookie(c, app, middleware.CSRFCookie, "", "/", -1, false)
+}
+
+func setAuthCookie(c *gin.Context, app *config.App, name, value, path string, maxAge int, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   app.Cookie.Domain,
+		MaxAge:   maxAge,
+		Secure:   app.Cookie.Secure,
+		HttpOnly: httpOnly,
+		SameSite: app.Cookie.SameSite,
+	})
+}
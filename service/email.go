@@ -3,21 +3,16 @@ package service
 import (
 	"bytes"
 	"fmt"
+	"html"
 	"net/smtp"
+	"time"
 
 	"github.com/chrisprojs/Franchiso/config"
 )
 
-// SendVerificationEmail sends verification email with code
-func SendVerificationEmail(emailConfig *config.EmailConfig, toEmail, toName, verificationCode string) error {
-	// Set up authentication
-	auth := smtp.PlainAuth("", emailConfig.SMTPUsername, emailConfig.SMTPPassword, emailConfig.SMTPHost)
-
-	// Email subject
-	subject := "Email Verification Code - Franchiso"
-
-	// Email body (HTML format)
-	body := fmt.Sprintf(`
+// emailTemplate is the HTML layout shared by every transactional email.
+// Placeholders: title, recipient name, intro, highlighted box content, attention note, closing note.
+const emailTemplate = `
 <!DOCTYPE html>
 <html>
 <head>
@@ -60,6 +55,15 @@ func SendVerificationEmail(emailConfig *config.EmailConfig, toEmail, toName, ver
 			color: #2c3e50;
 			font-family: 'Courier New', monospace;
 		}
+		.button {
+			display: inline-block;
+			background-color: #3498db;
+			color: #ffffff !important;
+			text-decoration: none;
+			font-weight: bold;
+			padding: 12px 24px;
+			border-radius: 4px;
+		}
 		.footer {
 			margin-top: 30px;
 			padding-top: 20px;
@@ -80,22 +84,22 @@ func SendVerificationEmail(emailConfig *config.EmailConfig, toEmail, toName, ver
 <body>
 	<div class="container">
 		<div class="header">
-			<h1>Verify Your Email</h1>
+			<h1>%s</h1>
 		</div>
 		
 		<p>Hello <strong>%s</strong>,</p>
 		
-		<p>Thank you for registering with Franchiso. To complete the registration process, please use the following verification code:</p>
+		<p>%s</p>
 		
 		<div class="code-box">
-			<div class="code">%s</div>
+			%s
 		</div>
 		
 		<div class="warning">
-			<strong>Attention:</strong> This code is only valid for 10 minutes. Do not share this code with anyone.
+			<strong>Attention:</strong> %s
 		</div>
 		
-		<p>If you did not perform this registration, please ignore this email.</p>
+		<p>%s</p>
 		
 		<div class="footer">
 			<p>This email was sent automatically, please do not reply to this email.</p>
@@ -104,7 +108,178 @@ func SendVerificationEmail(emailConfig *config.EmailConfig, toEmail, toName, ver
 	</div>
 </body>
 </html>
-`, toName, verificationCode)
+`
+
+// renderCodeEmail renders an email whose highlighted box is a one-time code
+func renderCodeEmail(title, toName, intro, code, validity, closing string) string {
+	return fmt.Sprintf(emailTemplate,
+		title,
+		html.EscapeString(toName),
+		intro,
+		fmt.Sprintf(`<div class="code">%s</div>`, code),
+		fmt.Sprintf("This code is only valid for %s. Do not share this code with anyone.", validity),
+		closing,
+	)
+}
+
+// renderLinkEmail renders an email whose highlighted box is a call-to-action button
+func renderLinkEmail(title, toName, intro, link, buttonText, attention, closing string) string {
+	return fmt.Sprintf(emailTemplate,
+		title,
+		html.EscapeString(toName),
+		intro,
+		fmt.Sprintf(`<a class="button" href="%s">%s</a>`, html.EscapeString(link), buttonText),
+		attention,
+		closing,
+	)
+}
+
+// SendVerificationEmail sends verification email with code
+func SendVerificationEmail(emailConfig *config.EmailConfig, toEmail, toName, verificationCode string) error {
+	// Email subject
+	subject := "Email Verification Code - Franchiso"
+
+	// Email body (HTML format)
+	body := renderCodeEmail(
+		"Verify Your Email",
+		toName,
+		"Thank you for registering with Franchiso. To complete the registration process, please use the following verification code:",
+		verificationCode,
+		"10 minutes",
+		"If you did not perform this registration, please ignore this email.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendPasswordResetEmail sends the one-time code used to reset a forgotten password
+func SendPasswordResetEmail(emailConfig *config.EmailConfig, toEmail, toName, resetCode string) error {
+	subject := "Password Reset Code - Franchiso"
+
+	body := renderCodeEmail(
+		"Reset Your Password",
+		toName,
+		"We received a request to reset the password of your Franchiso account. Please use the following code to choose a new password:",
+		resetCode,
+		"15 minutes",
+		"If you did not request a password reset, please ignore this email. Your password will not be changed.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendEmailLoginEmail sends the passwordless sign-in link together with a code that can be typed instead
+func SendEmailLoginEmail(emailConfig *config.EmailConfig, toEmail, toName, loginLink, code string) error {
+	subject := "Your Sign-in Link - Franchiso"
+
+	body := renderLinkEmail(
+		"Sign In to Franchiso",
+		toName,
+		fmt.Sprintf("Click the button below to sign in to your Franchiso account without a password. You can also enter this code on the sign-in page:<br><br><strong style=\"font-size: 24px; letter-spacing: 4px;\">%s</strong>", code),
+		loginLink,
+		"Sign In",
+		"The link and the code are only valid for 15 minutes and can only be used once. Do not share them with anyone.",
+		"If you did not try to sign in, please ignore this email.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendAdminInvitationEmail sends the link a new staff member uses to create their account
+func SendAdminInvitationEmail(emailConfig *config.EmailConfig, toEmail, role, invitationLink string) error {
+	subject := "You are invited to Franchiso"
+
+	body := renderLinkEmail(
+		"Join the Franchiso Team",
+		toEmail,
+		fmt.Sprintf("You have been invited to join Franchiso as <strong>%s</strong>. Click the button below to set up your account:", role),
+		invitationLink,
+		"Accept Invitation",
+		"This invitation is only valid for 72 hours and can only be used once. Do not forward this email.",
+		"If you were not expecting this invitation, please ignore this email.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendEmailChangeCode sends the code confirming a new email address
+func SendEmailChangeCode(emailConfig *config.EmailConfig, toEmail, toName, verificationCode string) error {
+	subject := "Confirm Your New Email - Franchiso"
+
+	body := renderCodeEmail(
+		"Confirm Your New Email",
+		toName,
+		"We received a request to use this address for your Franchiso account. Please use the following code to confirm it:",
+		verificationCode,
+		"15 minutes",
+		"If you did not request this change, please ignore this email.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendEmailChangedNotice tells the previous address that the account email was changed
+func SendEmailChangedNotice(emailConfig *config.EmailConfig, toEmail, toName, newEmail string) error {
+	subject := "Your Franchiso Email Has Been Changed"
+
+	body := renderLinkEmail(
+		"Email Address Changed",
+		toName,
+		fmt.Sprintf("The email address of your Franchiso account has been changed to <strong>%s</strong>. If you made this change, no further action is needed.", html.EscapeString(newEmail)),
+		fmt.Sprintf("%s/forgot-password", emailConfig.AppBaseURL),
+		"Secure My Account",
+		"If you did not make this change, please contact our support team immediately.",
+		"This is an automated notification, please do not reply.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendAccountLockedEmail tells the owner that their account was locked after repeated failed attempts
+func SendAccountLockedEmail(emailConfig *config.EmailConfig, toEmail, toName string, lockedUntil time.Time) error {
+	subject := "Your Franchiso Account Has Been Temporarily Locked"
+
+	body := renderLinkEmail(
+		"Account Temporarily Locked",
+		toName,
+		fmt.Sprintf("We detected several failed sign-in attempts on your Franchiso account, so it has been locked until <strong>%s</strong>. If these attempts were not made by you, we recommend resetting your password:", lockedUntil.Format("02 Jan 2006 15:04 MST")),
+		fmt.Sprintf("%s/forgot-password", emailConfig.AppBaseURL),
+		"Reset Password",
+		"You can sign in again after the lock expires. Never share your password or verification codes with anyone.",
+		"If it was you, no further action is needed.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// SendSuspiciousLoginEmail tells the user about a login from a new device or country,
+// with a link that signs that session out
+func SendSuspiciousLoginEmail(emailConfig *config.EmailConfig, toEmail, toName, reason, userAgent, ip, location string, loginAt time.Time, reportLink string) error {
+	subject := "New Sign-in to Your Franchiso Account"
+
+	body := renderLinkEmail(
+		"New Sign-in Detected",
+		toName,
+		fmt.Sprintf("Your Franchiso account was just signed in to from %s:<br><br><strong>Time:</strong> %s<br><strong>Device:</strong> %s<br><strong>IP address:</strong> %s<br><strong>Location:</strong> %s<br><br>If this wasn't you, sign that session out right away:",
+			reason,
+			loginAt.Format("02 Jan 2006 15:04 MST"),
+			html.EscapeString(userAgent),
+			html.EscapeString(ip),
+			html.EscapeString(location),
+		),
+		reportLink,
+		"This Wasn't Me",
+		"After signing the session out, reset your password so it cannot be used again.",
+		"If it was you, no further action is needed.",
+	)
+
+	return sendEmail(emailConfig, toEmail, subject, body)
+}
+
+// sendEmail delivers an HTML email through the configured SMTP account
+func sendEmail(emailConfig *config.EmailConfig, toEmail, subject, body string) error {
+	// Set up authentication
+	auth := smtp.PlainAuth("", emailConfig.SMTPUsername, emailConfig.SMTPPassword, emailConfig.SMTPHost)
 
 	// Build email message
 	msg := bytes.Buffer{}
@@ -0,0 +1,214 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const (
+	emailLoginCooldown    = time.Minute
+	emailLoginMaxAttempts = 3
+)
+
+type EmailLoginRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// VerifyEmailLoginRequest takes either the token of the emailed link, or the email with the typed code
+type VerifyEmailLoginRequest struct {
+	Token string `json:"token"`
+	Email string `json:"email"`
+	Code  string `json:"code"`
+}
+
+// PendingEmailLogin is kept in Redis until the link or the code is used
+type PendingEmailLogin struct {
+	UserID  string `json:"user_id"`
+	Code    string `json:"code"`
+	TokenID string `json:"token_id"` // jti of the signed link token
+}
+
+func emailLoginKey(email string) string {
+	return fmt.Sprintf("email_login:%s", strings.ToLower(email))
+}
+
+func emailLoginAttemptKey(email string) string {
+	return fmt.Sprintf("email_login_attempt:%s", strings.ToLower(email))
+}
+
+// RequestEmailLogin emails a single-use sign-in link and code, as an alternative to the password.
+// The response is the same whether or not the email is registered.
+func RequestEmailLogin(c *gin.Context, app *config.App) {
+	var req EmailLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	genericResponse := gin.H{
+		"message": "If the email is registered, a sign-in link has been sent to it",
+	}
+
+	ctx := context.Background()
+	cooldownKey := fmt.Sprintf("email_login_cooldown:%s", strings.ToLower(req.Email))
+	// Only one link per minute to avoid flooding the mailbox
+	ok, err := app.Redis.SetNX(ctx, cooldownKey, "1", emailLoginCooldown).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process sign-in request"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait a moment before requesting another link"})
+		return
+	}
+
+	var user models.User
+	err = app.DB.Model(&user).Where("email = ?", req.Email).Select()
+	if err != nil {
+		c.JSON(http.StatusOK, genericResponse)
+		return
+	}
+
+	code, err := utils.GenerateVerificationCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sign-in code"})
+		return
+	}
+	// The link carries a token signed like our other JWTs, its jti ties it to the pending login
+	token, err := utils.GenerateJWT(user.ID.String(), user.Role, "", "email_login")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sign-in link"})
+		return
+	}
+	claims, err := utils.ValidateJWT(token, "email_login")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate sign-in link"})
+		return
+	}
+
+	pendingJSON, err := json.Marshal(PendingEmailLogin{
+		UserID:  user.ID.String(),
+		Code:    code,
+		TokenID: claims.ID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare sign-in link"})
+		return
+	}
+
+	// A new request replaces the previous link and code
+	pipe := app.Redis.TxPipeline()
+	pipe.Set(ctx, emailLoginKey(user.Email), string(pendingJSON), utils.EmailLoginTokenTTL)
+	pipe.Set(ctx, emailLoginAttemptKey(user.Email), "0", utils.EmailLoginTokenTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store sign-in link"})
+		return
+	}
+
+	loginLink := fmt.Sprintf("%s/login/email-link?token=%s", app.Email.AppBaseURL, url.QueryEscape(token))
+	err = SendEmailLoginEmail(app.Email, user.Email, user.Name, loginLink, code)
+	if err != nil {
+		fmt.Printf("Warning: Failed to send sign-in link to %s: %v\n", user.Email, err)
+	}
+
+	c.JSON(http.StatusOK, genericResponse)
+}
+
+// VerifyEmailLogin consumes the emailed link or code and signs the user in like Login does,
+// including the two-factor step when it applies
+func VerifyEmailLogin(c *gin.Context, app *config.App) {
+	var req VerifyEmailLoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Token == "" && (req.Email == "" || req.Code == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "token, or email and code are required"})
+		return
+	}
+
+	var user models.User
+	var tokenID string
+	if req.Token != "" {
+		claims, err := utils.ValidateJWT(req.Token, "email_login")
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link is invalid or has expired. Please request a new one"})
+			return
+		}
+		if err := app.DB.Model(&user).Where("id = ?", claims.UserID).Select(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link is invalid or has expired. Please request a new one"})
+			return
+		}
+		tokenID = claims.ID
+	} else {
+		if err := app.DB.Model(&user).Where("email = ?", req.Email).Select(); err != nil {
+			recordAuthFailure(c, app, emailLoginThrottle, req.Email, "")
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in code is invalid or has expired. Please request a new one"})
+			return
+		}
+	}
+
+	if !checkAuthThrottle(c, app, emailLoginThrottle, user.Email) {
+		return
+	}
+
+	ctx := context.Background()
+	pendingKey := emailLoginKey(user.Email)
+	attemptKey := emailLoginAttemptKey(user.Email)
+
+	pendingData, err := app.Redis.Get(ctx, pendingKey).Result()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link is invalid or has expired. Please request a new one"})
+		return
+	}
+	var pending PendingEmailLogin
+	if err := json.Unmarshal([]byte(pendingData), &pending); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read sign-in data"})
+		return
+	}
+
+	if tokenID != "" {
+		// An older link replaced by a newer request no longer works
+		if pending.TokenID != tokenID || pending.UserID != user.ID.String() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link is invalid or has expired. Please request a new one"})
+			return
+		}
+	} else if !strings.EqualFold(pending.Code, strings.TrimSpace(req.Code)) {
+		recordAuthFailure(c, app, emailLoginThrottle, user.Email, user.Name)
+		attempts, err := app.Redis.Incr(ctx, attemptKey).Result()
+		if err != nil || attempts >= emailLoginMaxAttempts {
+			app.Redis.Del(ctx, pendingKey, attemptKey)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in attempts have reached the maximum limit (3 times). Please request a new link"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":              "Incorrect sign-in code",
+			"remaining_attempts": emailLoginMaxAttempts - attempts,
+		})
+		return
+	}
+
+	// Deleting the pending login is what makes the link single-use: only one of
+	// two concurrent requests can delete it
+	deleted, err := app.Redis.Del(ctx, pendingKey).Result()
+	if err != nil || deleted == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Sign-in link has already been used. Please request a new one"})
+		return
+	}
+	app.Redis.Del(ctx, attemptKey)
+	clearAuthFailures(app, emailLoginThrottle, user.Email)
+
+	// Issue the session, or ask for the second factor when two-factor authentication applies
+	completeLogin(c, app, &user)
+}
@@ -7,14 +7,15 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/middleware"
 	"github.com/chrisprojs/Franchiso/models"
 	"github.com/chrisprojs/Franchiso/utils"
 	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
 	"github.com/google/uuid"
 	"github.com/olivere/elastic/v7"
 
@@ -32,6 +33,7 @@ type UploadFranchiseRequest struct {
 	YearFounded     string `form:"year_founded" binding:"required"`
 	Website         string `form:"website" binding:"required"`
 	WhatsappContact string `form:"whatsapp_contact" binding:"required"`
+	Packages        string `form:"packages"` // optional JSON array of FranchisePackageInput
 
 	// Files
 	Logo     *multipart.FileHeader   `form:"logo"`
@@ -54,18 +56,44 @@ func UploadFranchise(c *gin.Context, app *config.App) {
 		return
 	}
 
-	role := c.GetString("role")
-	if role != "Franchisor" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User does not have access"})
-		return
-	}
-
 	userID := c.GetString("user_id")
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
 		return
 	}
 
+	franchise := models.Franchise{
+		ID:        uuid.New(),
+		UserID:    uuid.MustParse(userID),
+		IsBoosted: false,
+		Status:    models.FranchiseStatusPending,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	fields := FranchiseFields{
+		CategoryID:      &req.CategoryID,
+		Brand:           &req.Brand,
+		Description:     &req.Description,
+		Investment:      &req.Investment,
+		MonthlyRevenue:  &req.MonthlyRevenue,
+		ROI:             &req.ROI,
+		BranchCount:     &req.BranchCount,
+		YearFounded:     &req.YearFounded,
+		Website:         &req.Website,
+		WhatsappContact: &req.WhatsappContact,
+	}
+	// Validate before any file is uploaded, a rejected franchise leaves nothing behind
+	if _, fieldErrors := applyFranchiseFields(c.Request.Context(), app, &franchise, nil, fields); len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid franchise", "fields": fieldErrors})
+		return
+	}
+	packages, fieldErrors := parseFranchisePackages(req.Packages, &franchise)
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid packages", "fields": fieldErrors})
+		return
+	}
+	franchise.Packages = packages
+
 	// Upload logo
 	var logoUrl string
 	if req.Logo != nil {
@@ -117,58 +145,21 @@ func UploadFranchise(c *gin.Context, app *config.App) {
 		npwpUrl, _ = utils.UploadToStorageProxy(req.Npwp)
 	}
 
-	investment, err := strconv.Atoi(req.Investment)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid investment value"})
-		return
-	}
-	monthlyRevenue, err := strconv.Atoi(req.MonthlyRevenue)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid monthly revenue value"})
-		return
-	}
-	roi, err := strconv.Atoi(req.ROI)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ROI value"})
-		return
-	}
-	branchCount, err := strconv.Atoi(req.BranchCount)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch count value"})
-		return
-	}
-	yearFounded, err := strconv.Atoi(req.YearFounded)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year founded value"})
-		return
-	}
-
-	// Save franchise
-	franchise := models.Franchise{
-		ID:              uuid.New(),
-		UserID:          uuid.MustParse(userID),
-		CategoryID:      uuid.MustParse(req.CategoryID),
-		Brand:           req.Brand,
-		Logo:            logoUrl,
-		AdPhotos:        adPhotoUrls,
-		Description:     req.Description,
-		Investment:      investment,
-		MonthlyRevenue:  monthlyRevenue,
-		ROI:             roi,
-		BranchCount:     branchCount,
-		YearFounded:     yearFounded,
-		Website:         req.Website,
-		WhatsappContact: req.WhatsappContact,
-		IsBoosted:       false,
-		Stpw:            stpwUrl,
-		NIB:             nibUrl,
-		NPWP:            npwpUrl,
-		Status:          "Menunggu Verifikasi",
-		CreatedAt:       time.Now(),
-		UpdatedAt:       time.Now(),
-	}
+	franchise.Logo = logoUrl
+	franchise.AdPhotos = adPhotoUrls
+	franchise.Stpw = stpwUrl
+	franchise.NIB = nibUrl
+	franchise.NPWP = npwpUrl
 
-	_, err = app.DB.Model(&franchise).Insert()
+	err := app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(&franchise).Insert(); err != nil {
+			return err
+		}
+		if err := saveFranchisePackages(tx, &franchise, []string{franchisePackagesColumn}); err != nil {
+			return err
+		}
+		return recordFranchiseRevision(tx, nil, &franchise, userID, models.RevisionActionCreate, nil)
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save franchise data: %v", err)})
 		return
@@ -193,6 +184,7 @@ type EditFranchiseRequest struct {
 	YearFounded     *string `form:"year_founded"`
 	Website         *string `form:"website"`
 	WhatsappContact *string `form:"whatsapp_contact"`
+	Packages        *string `form:"packages"` // JSON array of FranchisePackageInput, replaces every package
 
 	// Files
 	Logo     *multipart.FileHeader   `form:"logo"`
@@ -211,90 +203,47 @@ func EditFranchise(c *gin.Context, app *config.App) {
 		return
 	}
 
-	role := c.GetString("role")
-	if role != "Franchisor" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User does not have access"})
-		return
-	}
-
 	userID := c.GetString("user_id")
 	franchise := &models.Franchise{}
 	err := app.DB.Model(franchise).
-		Where("id = ?", franchiseID).
-		Where("user_id = ?", userID).
+		Relation("Packages", orderPackages).
+		Where("franchise.id = ?", franchiseID).
+		Where("franchise.user_id = ?", userID).
 		Select()
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
 		return
 	}
-
-	columnsToUpdate := []string{}
+	before := *franchise
 
 	// Update fields if provided
-	if req.CategoryID != nil && franchise.CategoryID.String() != *req.CategoryID {
-		franchise.CategoryID = uuid.MustParse(*req.CategoryID)
-		columnsToUpdate = append(columnsToUpdate, "category_id")
-	}
-	if req.Brand != nil && franchise.Brand != *req.Brand {
-		franchise.Brand = *req.Brand
-		columnsToUpdate = append(columnsToUpdate, "brand")
-	}
-	if req.Description != nil && franchise.Description != *req.Description {
-		franchise.Description = *req.Description
-		columnsToUpdate = append(columnsToUpdate, "description")
-	}
-	investment, err := strconv.Atoi(*req.Investment)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid investment value"})
-		return
-	}
-	if req.Investment != nil && franchise.Investment != investment {
-		franchise.Investment = investment
-		columnsToUpdate = append(columnsToUpdate, "investment")
-	}
-	monthlyRevenue, err := strconv.Atoi(*req.MonthlyRevenue)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid monthly revenue value"})
-		return
-	}
-	if req.MonthlyRevenue != nil && franchise.MonthlyRevenue != monthlyRevenue {
-		franchise.MonthlyRevenue = monthlyRevenue
-		columnsToUpdate = append(columnsToUpdate, "monthly_revenue")
-	}
-	roi, err := strconv.Atoi(*req.ROI)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ROI value"})
-		return
-	}
-	if req.ROI != nil && franchise.ROI != roi {
-		franchise.ROI = roi
-		columnsToUpdate = append(columnsToUpdate, "roi")
-	}
-	branchCount, err := strconv.Atoi(*req.BranchCount)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid branch count value"})
-		return
-	}
-	if req.BranchCount != nil && franchise.BranchCount != branchCount {
-		franchise.BranchCount = branchCount
-		columnsToUpdate = append(columnsToUpdate, "branch_count")
+	fields := FranchiseFields{
+		CategoryID:      req.CategoryID,
+		Brand:           req.Brand,
+		Description:     req.Description,
+		Investment:      req.Investment,
+		MonthlyRevenue:  req.MonthlyRevenue,
+		ROI:             req.ROI,
+		BranchCount:     req.BranchCount,
+		YearFounded:     req.YearFounded,
+		Website:         req.Website,
+		WhatsappContact: req.WhatsappContact,
 	}
-	yearFounded, err := strconv.Atoi(*req.YearFounded)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid year founded value"})
+	columnsToUpdate, fieldErrors := applyFranchiseFields(c.Request.Context(), app, franchise, &before, fields)
+	if len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid franchise", "fields": fieldErrors})
 		return
 	}
-	if req.YearFounded != nil && franchise.YearFounded != yearFounded {
-		franchise.YearFounded = yearFounded
-		columnsToUpdate = append(columnsToUpdate, "year_founded")
-	}
-	if req.Website != nil && franchise.Website != *req.Website {
-		franchise.Website = *req.Website
-		columnsToUpdate = append(columnsToUpdate, "website")
-	}
-	if req.WhatsappContact != nil && franchise.WhatsappContact != *req.WhatsappContact {
-		franchise.WhatsappContact = *req.WhatsappContact
-		columnsToUpdate = append(columnsToUpdate, "whatsapp_contact")
+	if req.Packages != nil {
+		packages, fieldErrors := parseFranchisePackages(*req.Packages, franchise)
+		if len(fieldErrors) > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid packages", "fields": fieldErrors})
+			return
+		}
+		if !sameColumnValue(franchise.Packages, packages) {
+			franchise.Packages = packages
+			columnsToUpdate = append(columnsToUpdate, franchisePackagesColumn)
+		}
 	}
 
 	// Logo
@@ -336,7 +285,7 @@ func EditFranchise(c *gin.Context, app *config.App) {
 	}
 
 	// NPWP, NIB, SPTW can only be edited if status is Rejected/Waiting for Verification
-	if franchise.Status != "Terverifikasi" {
+	if franchise.Status != models.FranchiseStatusVerified {
 		if req.Stpw != nil {
 			stpwUrl, err := utils.UploadToStorageProxy(req.Stpw)
 			if err != nil {
@@ -366,99 +315,36 @@ func EditFranchise(c *gin.Context, app *config.App) {
 		}
 	}
 
-	if franchise.Status == "Ditolak" {
-		franchise.Status = "Menunggu Verifikasi"
-		columnsToUpdate = append(columnsToUpdate, "status")
-	}
-	franchise.UpdatedAt = time.Now()
-
-	_, err = app.DB.Model(franchise).
-		Column(columnsToUpdate...).
-		WherePK().
-		Where("user_id = ?", userID).
-		Update()
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update franchise: %v", err)})
+	// Edits to a verified listing go live only after review
+	if franchise.Status == models.FranchiseStatusVerified {
+		holdVerifiedFranchiseEdit(c, app, &before, franchise, columnsToUpdate)
 		return
 	}
 
-	// Elasticsearch sync if verified
-	if franchise.Status == "Terverifikasi" {
-		var user models.User
-		if franchise.User != nil {
-			user = *franchise.User
-		}
-		var category models.Category
-		if franchise.Category != nil {
-			category = *franchise.Category
-		}
-
-		// Convert logo and ad_photos to VectorizedImage structure
-		logoVectorized, err := utils.ConvertToVectorizedImage(franchise.Logo)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
-		adPhotosVectorized, err := utils.ConvertToVectorizedImages(franchise.AdPhotos)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-			return
-		}
+	if franchise.Status == models.FranchiseStatusRejected {
+		franchise.Status = models.FranchiseStatusPending
+		columnsToUpdate = append(columnsToUpdate, "status")
+	}
+	franchise.UpdatedAt = time.Now()
 
-		doc := map[string]interface{}{
-			"id": franchise.ID.String(),
-			"user": map[string]interface{}{
-				"user_id": franchise.UserID.String(),
-				"name":    user.Name,
-			},
-			"category": map[string]interface{}{
-				"category_id": franchise.CategoryID.String(),
-				"category":    category.Category,
-			},
-			"brand":            franchise.Brand,
-			"logo":             logoVectorized,
-			"ad_photos":        adPhotosVectorized,
-			"description":      franchise.Description,
-			"investment":       franchise.Investment,
-			"monthly_revenue":  franchise.MonthlyRevenue,
-			"roi":              franchise.ROI,
-			"branch_count":     franchise.BranchCount,
-			"year_founded":     franchise.YearFounded,
-			"website":          franchise.Website,
-			"whatsapp_contact": franchise.WhatsappContact,
-			"is_boosted":       franchise.IsBoosted,
-			"created_at":       franchise.CreatedAt,
-			"updated_at":       franchise.UpdatedAt,
-		}
-
-		// Generate text embedding if franchise is boosted
-		if franchise.IsBoosted && os.Getenv("GEMINI_ACTIVE") == "true" && app.Gemini != nil {
-			textForEmbedding := franchise.Brand + " " + franchise.Description
-			embeddingRes, err := app.Gemini.Models.EmbedContent(context.Background(), "text-embedding-004", genai.Text(textForEmbedding), nil)
+	columnsToUpdate = append(columnsToUpdate, "updated_at")
+	err = app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.Model(franchise).
+			Column(franchiseTableColumns(columnsToUpdate)...).
+			WherePK().
+			Where("user_id = ?", userID).
+			Update()
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate embedding: " + err.Error()})
-			return
-		}
-			if len(embeddingRes.Embeddings) > 0 {
-				// Convert []float32 to []float64 for Elasticsearch
-				textVector := make([]float64, len(embeddingRes.Embeddings[0].Values))
-				for i, v := range embeddingRes.Embeddings[0].Values {
-					textVector[i] = float64(v)
-				}
-				doc["text_vector"] = textVector
-			}
+			return err
 		}
-
-		_, err = app.ES.Index().
-			Index("franchises").
-			Id(franchise.ID.String()).
-			BodyJson(doc).
-			Refresh("true").
-			Do(context.Background())
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to synchronize to Elasticsearch"})
-			return
+		if err := saveFranchisePackages(tx, franchise, columnsToUpdate); err != nil {
+			return err
 		}
+		return recordFranchiseRevision(tx, &before, franchise, userID, models.RevisionActionEdit, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update franchise: %v", err)})
+		return
 	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Franchise updated successfully"})
@@ -474,6 +360,7 @@ func DisplayFranchiseDetailByID(c *gin.Context, app *config.App) {
 		err := app.DB.Model(franchise).
 			Relation("User").
 			Relation("Category").
+			Relation("Packages", orderPackages).
 			Where("franchise.id = ?", franchiseID).
 			Select()
 		if err != nil {
@@ -483,7 +370,7 @@ func DisplayFranchiseDetailByID(c *gin.Context, app *config.App) {
 
 		role := c.GetString("role")
 		userID := c.GetString("user_id")
-		if role != "Admin" && !(role == "Franchisor" && userID == franchise.UserID.String()) {
+		if !middleware.HasPermission(app, role, models.PermFranchiseViewPrivate) && userID != franchise.UserID.String() {
 			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
 			return
 		}
@@ -524,16 +411,11 @@ func DisplayMyFranchises(c *gin.Context, app *config.App) {
 		return
 	}
 
-	role := c.GetString("role")
-	if role != "Franchisor" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User does not have access"})
-		return
-	}
-
 	var franchises []models.Franchise
 	err := app.DB.Model(&franchises).
-		Where("user_id = ?", userID).
+		Where("franchise.user_id = ?", userID).
 		Relation("Category").
+		Relation("Packages", orderPackages).
 		Select()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch franchise data"})
@@ -552,6 +434,10 @@ type SearchFranchiseRequest struct {
 	Category          *string               `form:"category"`
 	MinInvestment     *int                  `form:"min_investment"`
 	MaxInvestment     *int                  `form:"max_investment"`
+	MaxArea           *int                  `form:"max_area"` // only packages that fit in this many square meters
+	NearLat           *float64              `form:"near_lat"`  // near_lat, near_lng and within_km together keep the
+	NearLng           *float64              `form:"near_lng"`  // franchises with an outlet within that many kilometers
+	WithinKm          *float64              `form:"within_km"`
 	MinMonthlyRevenue *int                  `form:"min_monthly_revenue"`
 	MinROI            *int                  `form:"min_roi"`
 	MaxROI            *int                  `form:"max_roi"`
@@ -579,6 +465,11 @@ func SearchingFranchise(c *gin.Context, app *config.App) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	nearOutlet := req.NearLat != nil || req.NearLng != nil || req.WithinKm != nil
+	if nearOutlet && (req.NearLat == nil || req.NearLng == nil || req.WithinKm == nil || *req.WithinKm <= 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "near_lat, near_lng and a positive within_km must be given together"})
+		return
+	}
 
 	searchService := app.ES.Search().Index("franchises")
 
@@ -723,15 +614,18 @@ func SearchingFranchise(c *gin.Context, app *config.App) {
 		)
 	}
 
-	if req.MinInvestment != nil || req.MaxInvestment != nil {
-		q := elastic.NewRangeQuery("investment")
-		if req.MinInvestment != nil {
-			q.Gte(*req.MinInvestment)
-		}
-		if req.MaxInvestment != nil {
-			q.Lte(*req.MaxInvestment)
-		}
-		filterQuery.Filter(q)
+	// The investment range also matches any package of the franchise
+	if req.MinInvestment != nil || req.MaxInvestment != nil || req.MaxArea != nil {
+		filterQuery.Filter(packageInvestmentFilter(req.MinInvestment, req.MaxInvestment, req.MaxArea))
+	}
+
+	if nearOutlet {
+		filterQuery.Filter(
+			elastic.NewGeoDistanceQuery("outlets.location").
+				Lat(*req.NearLat).
+				Lon(*req.NearLng).
+				Distance(fmt.Sprintf("%gkm", *req.WithinKm)),
+		)
 	}
 
 	if req.MinMonthlyRevenue != nil {
@@ -909,17 +803,12 @@ func CategoryList(c *gin.Context, app *config.App) {
 	c.JSON(http.StatusOK, response)
 }
 
-// DeleteFranchise deletes franchise data from Postgres, and if the status
-// is "Verified" then also deletes its document from Elasticsearch.
+// DeleteFranchise archives a franchise of the user. It leaves Elasticsearch right away and
+// can be restored during FranchiseRetentionPeriod, after that purge_archived_franchises
+// removes it together with its related rows and files.
 func DeleteFranchise(c *gin.Context, app *config.App) {
 	franchiseID := c.Param("id")
 
-	role := c.GetString("role")
-	if role != "Franchisor" {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User tidak memiliki akses"})
-		return
-	}
-
 	userID := c.GetString("user_id")
 	if userID == "" {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User tidak terautentikasi"})
@@ -938,31 +827,32 @@ func DeleteFranchise(c *gin.Context, app *config.App) {
 	}
 
 	// If verified, delete from Elasticsearch first
-	if franchise.Status == "Terverifikasi" {
-		_, err := app.ES.Delete().
-			Index("franchises").
-			Id(franchise.ID.String()).
-			Refresh("true").
-			Do(context.Background())
-		if err != nil {
-			if esErr, ok := err.(*elastic.Error); ok && esErr.Status == http.StatusNotFound {
-				// Ignore if document not found in ES
-			} else {
-				c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus franchise dari Elasticsearch"})
-				return
-			}
+	if franchise.Status == models.FranchiseStatusVerified {
+		if err := deleteFranchiseFromES(app, franchise.ID.String()); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Gagal menghapus franchise dari Elasticsearch"})
+			return
 		}
 	}
 
-	// Delete from Postgres
-	_, err = app.DB.Model((*models.Franchise)(nil)).
-		Where("id = ?", franchiseID).
-		Where("user_id = ?", userID).
-		Delete()
+	// Archive in Postgres, pending changes are withdrawn so they leave the review queue
+	err = app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.Model((*models.FranchiseChangeRequest)(nil)).
+			Where("franchise_id = ?", franchise.ID).
+			Where("status = ?", models.ChangeRequestPending).
+			Delete()
+		if err != nil {
+			return err
+		}
+		_, err = tx.Model(franchise).WherePK().Delete()
+		return err
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Gagal menghapus franchise: %v", err)})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Franchise berhasil dihapus"})
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Franchise berhasil dihapus",
+		"permanent_from": franchise.DeletedAt.Add(FranchiseRetentionPeriod),
+	})
 }
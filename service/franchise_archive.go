@@ -0,0 +1,77 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+)
+
+// FranchiseRetentionPeriod is how long an archived franchise can still be restored
+// before purge_archived_franchises removes it for good
+const FranchiseRetentionPeriod = 30 * 24 * time.Hour
+
+type ArchivedFranchisesResponse struct {
+	Franchises []models.Franchise `json:"franchises"`
+}
+
+// DisplayArchivedFranchises lists the archived franchises of the user, most recently archived first
+func DisplayArchivedFranchises(c *gin.Context, app *config.App) {
+	franchises := []models.Franchise{}
+	err := app.DB.Model(&franchises).
+		Relation("Category").
+		Relation("Packages", orderPackages).
+		Where("franchise.user_id = ?", c.GetString("user_id")).
+		Deleted().
+		Order("franchise.deleted_at DESC").
+		Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch archived franchises"})
+		return
+	}
+	c.JSON(http.StatusOK, ArchivedFranchisesResponse{Franchises: franchises})
+}
+
+// RestoreFranchise brings an archived franchise of the user back during the retention period.
+// It returns in the status it had, a verified listing is indexed again.
+func RestoreFranchise(c *gin.Context, app *config.App) {
+	franchise := &models.Franchise{}
+	err := app.DB.Model(franchise).
+		Where("id = ?", c.Param("id")).
+		Where("user_id = ?", c.GetString("user_id")).
+		Deleted().
+		Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Archived franchise not found"})
+		return
+	}
+	if time.Since(*franchise.DeletedAt) > FranchiseRetentionPeriod {
+		c.JSON(http.StatusGone, gin.H{"error": "The retention period has passed, the franchise can no longer be restored"})
+		return
+	}
+
+	franchise.DeletedAt = nil
+	franchise.UpdatedAt = time.Now()
+	_, err = app.DB.Model(franchise).
+		Column("deleted_at", "updated_at").
+		WherePK().
+		Deleted().
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to restore franchise: %v", err)})
+		return
+	}
+
+	if franchise.Status == models.FranchiseStatusVerified {
+		if err := indexFranchiseToES(app, franchise); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Franchise restored successfully", "franchise": franchise})
+}
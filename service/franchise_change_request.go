@@ -0,0 +1,317 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+)
+
+type ReviewFranchiseChangeRequest struct {
+	Status string `json:"status" binding:"required,oneof=approved rejected"`
+	Note   string `json:"note"`
+}
+
+type FranchiseChangeRequestsResponse struct {
+	ChangeRequests []models.FranchiseChangeRequest `json:"change_requests"`
+}
+
+// copyFranchiseColumn copies one tracked column from src to dst
+func copyFranchiseColumn(dst, src *models.Franchise, column string) {
+	for _, field := range franchiseTrackedFields {
+		if field.column == column {
+			reflect.ValueOf(dst).Elem().Field(field.index).Set(reflect.ValueOf(src).Elem().Field(field.index))
+			return
+		}
+	}
+}
+
+// holdVerifiedFranchiseEdit finishes EditFranchise for a verified listing. Columns that are
+// configured as auto-approved are written right away, every other column is merged into the
+// pending change request of the franchise and waits for a moderator.
+func holdVerifiedFranchiseEdit(c *gin.Context, app *config.App, live, edited *models.Franchise, columns []string) {
+	userID := c.GetString("user_id")
+
+	applied := *live
+	autoColumns := []string{}
+	reviewColumns := []string{}
+	for _, column := range columns {
+		if column == "updated_at" {
+			continue
+		}
+		if app.FranchiseReview.AutoApproveColumns[column] {
+			copyFranchiseColumn(&applied, edited, column)
+			autoColumns = append(autoColumns, column)
+		} else {
+			reviewColumns = append(reviewColumns, column)
+		}
+	}
+
+	var request *models.FranchiseChangeRequest
+	err := app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		// Lock the listing first, so concurrent edits of it cannot both find no pending
+		// request and insert one each
+		var lockedID uuid.UUID
+		err := tx.Model((*models.Franchise)(nil)).
+			Column("id").
+			Where("id = ?", live.ID).
+			For("UPDATE").
+			Select(&lockedID)
+		if err != nil {
+			return err
+		}
+
+		if len(autoColumns) > 0 {
+			applied.UpdatedAt = time.Now()
+			_, err := tx.Model(&applied).
+				Column(append(franchiseTableColumns(autoColumns), "updated_at")...).
+				WherePK().
+				Update()
+			if err != nil {
+				return err
+			}
+			if err := saveFranchisePackages(tx, &applied, autoColumns); err != nil {
+				return err
+			}
+			if err := recordFranchiseRevision(tx, live, &applied, userID, models.RevisionActionEdit, nil); err != nil {
+				return err
+			}
+		}
+
+		pending := &models.FranchiseChangeRequest{}
+		err = tx.Model(pending).
+			Where("franchise_id = ?", live.ID).
+			Where("status = ?", models.ChangeRequestPending).
+			For("UPDATE").
+			Select()
+		if err == pg.ErrNoRows {
+			pending = nil
+		} else if err != nil {
+			return err
+		}
+
+		// The proposal is the live listing with the earlier pending changes and then this edit
+		// on top, a column edited now replaces its pending value
+		proposed := applied
+		if pending != nil && pending.Proposed != nil {
+			for _, column := range pending.Columns {
+				if !containsString(columns, column) {
+					copyFranchiseColumn(&proposed, pending.Proposed, column)
+				}
+			}
+		}
+		for _, column := range reviewColumns {
+			copyFranchiseColumn(&proposed, edited, column)
+		}
+		proposed.User = nil
+		proposed.Category = nil
+
+		changes := diffFranchise(&applied, &proposed)
+		if len(changes) == 0 {
+			// The edit undid every pending change
+			if pending != nil {
+				_, err := tx.Model(pending).WherePK().Delete()
+				return err
+			}
+			return nil
+		}
+		changedColumns := make([]string, 0, len(changes))
+		for column := range changes {
+			changedColumns = append(changedColumns, column)
+		}
+		sort.Strings(changedColumns)
+
+		now := time.Now()
+		if pending == nil {
+			request = &models.FranchiseChangeRequest{
+				ID:          uuid.New(),
+				FranchiseID: live.ID,
+				UserID:      uuid.MustParse(userID),
+				Columns:     changedColumns,
+				Changes:     changes,
+				Proposed:    &proposed,
+				Status:      models.ChangeRequestPending,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			_, err := tx.Model(request).Insert()
+			return err
+		}
+		pending.Columns = changedColumns
+		pending.Changes = changes
+		pending.Proposed = &proposed
+		pending.UpdatedAt = now
+		_, err = tx.Model(pending).
+			Column("columns", "changes", "proposed", "updated_at").
+			WherePK().
+			Update()
+		request = pending
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update franchise: %v", err)})
+		return
+	}
+
+	if len(autoColumns) > 0 {
+		if err := indexFranchiseToES(app, &applied); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if request == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Franchise updated successfully"})
+		return
+	}
+	c.JSON(http.StatusAccepted, gin.H{
+		"message":        "Changes to a verified franchise are waiting for review",
+		"applied":        autoColumns,
+		"change_request": request,
+	})
+}
+
+// GetPendingFranchiseChange shows the pending change request of a franchise
+func GetPendingFranchiseChange(c *gin.Context, app *config.App) {
+	if _, ok := loadFranchiseForHistory(c, app); !ok {
+		return
+	}
+
+	request := &models.FranchiseChangeRequest{}
+	err := app.DB.Model(request).
+		Where("franchise_id = ?", c.Param("id")).
+		Where("status = ?", models.ChangeRequestPending).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending changes"})
+		return
+	}
+	c.JSON(http.StatusOK, request)
+}
+
+// WithdrawFranchiseChange lets the owner drop the pending changes before they are reviewed
+func WithdrawFranchiseChange(c *gin.Context, app *config.App) {
+	res, err := app.DB.Model((*models.FranchiseChangeRequest)(nil)).
+		Where("franchise_id = ?", c.Param("id")).
+		Where("status = ?", models.ChangeRequestPending).
+		Where("franchise_id IN (SELECT id FROM franchiso.franchises WHERE user_id = ?)", c.GetString("user_id")).
+		Delete()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to withdraw changes"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No pending changes"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Pending changes withdrawn"})
+}
+
+// DisplayFranchiseChangeRequests is the admin queue of change requests, oldest first.
+// ?status= selects approved or rejected requests instead of the pending ones.
+func DisplayFranchiseChangeRequests(c *gin.Context, app *config.App) {
+	status := c.DefaultQuery("status", models.ChangeRequestPending)
+
+	requests := []models.FranchiseChangeRequest{}
+	err := app.DB.Model(&requests).
+		Relation("Franchise").
+		Where("franchise_change_request.status = ?", status).
+		Order("franchise_change_request.created_at ASC").
+		Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch change requests: " + err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, FranchiseChangeRequestsResponse{ChangeRequests: requests})
+}
+
+// ReviewFranchiseChange approves or rejects a pending change request. An approved request is
+// written to the franchise as a new revision and the search document is updated.
+func ReviewFranchiseChange(c *gin.Context, app *config.App) {
+	var req ReviewFranchiseChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	reviewerID := uuid.MustParse(c.GetString("user_id"))
+
+	request := &models.FranchiseChangeRequest{}
+	franchise := &models.Franchise{}
+	err := app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		err := tx.Model(request).
+			Where("id = ?", c.Param("id")).
+			Where("status = ?", models.ChangeRequestPending).
+			For("UPDATE").
+			Select()
+		if err != nil {
+			return err
+		}
+
+		if req.Status == models.ChangeRequestApproved && request.Proposed != nil {
+			err := tx.Model(franchise).
+				Relation("Packages", orderPackages).
+				Where("franchise.id = ?", request.FranchiseID).
+				For("UPDATE OF franchise").
+				Select()
+			if err != nil {
+				return err
+			}
+			before := *franchise
+			for _, column := range request.Columns {
+				copyFranchiseColumn(franchise, request.Proposed, column)
+			}
+			franchise.UpdatedAt = time.Now()
+			_, err = tx.Model(franchise).
+				Column(append(franchiseTableColumns(request.Columns), "updated_at")...).
+				WherePK().
+				Update()
+			if err != nil {
+				return err
+			}
+			if err := saveFranchisePackages(tx, franchise, request.Columns); err != nil {
+				return err
+			}
+			if err := recordFranchiseRevision(tx, &before, franchise, reviewerID.String(), models.RevisionActionApprove, nil); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		request.Status = req.Status
+		request.ReviewedBy = &reviewerID
+		request.ReviewNote = req.Note
+		request.ReviewedAt = &now
+		request.UpdatedAt = now
+		_, err = tx.Model(request).
+			Column("status", "reviewed_by", "review_note", "reviewed_at", "updated_at").
+			WherePK().
+			Update()
+		return err
+	})
+	if err == pg.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Change request not found or already reviewed"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to review change request: %v", err)})
+		return
+	}
+
+	if req.Status == models.ChangeRequestApproved && franchise.Status == models.FranchiseStatusVerified {
+		if err := indexFranchiseToES(app, franchise); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": fmt.Sprintf("Change request %s", req.Status)})
+}
@@ -0,0 +1,492 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// Files of a draft, uploaded one request at a time
+const (
+	draftFileLogo     = "logo"
+	draftFileAdPhotos = "ad_photos"
+	draftFileStpw     = "stpw"
+	draftFileNib      = "nib"
+	draftFileNpwp     = "npwp"
+)
+
+// DraftFranchiseRequest holds the text fields of a draft. Every field is optional,
+// a field that is sent replaces the stored value and an empty value clears it.
+type DraftFranchiseRequest struct {
+	CategoryID      *string `form:"category_id" json:"category_id"`
+	Brand           *string `form:"brand" json:"brand"`
+	Description     *string `form:"description" json:"description"`
+	Investment      *string `form:"investment" json:"investment"`
+	MonthlyRevenue  *string `form:"monthly_revenue" json:"monthly_revenue"`
+	ROI             *string `form:"roi" json:"roi"`
+	BranchCount     *string `form:"branch_count" json:"branch_count"`
+	YearFounded     *string `form:"year_founded" json:"year_founded"`
+	Website         *string `form:"website" json:"website"`
+	WhatsappContact *string `form:"whatsapp_contact" json:"whatsapp_contact"`
+	Packages        *string `form:"packages" json:"packages"` // JSON array of FranchisePackageInput
+}
+
+type DraftFileRequest struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// DraftCompleteness lists what is still missing before a draft can be submitted
+type DraftCompleteness struct {
+	Complete bool               `json:"complete"`
+	Percent  int                `json:"percent"`
+	Missing  []utils.FieldError `json:"missing"`
+}
+
+type DraftFranchiseResponse struct {
+	Franchise    *models.Franchise `json:"franchise"`
+	Completeness DraftCompleteness `json:"completeness"`
+}
+
+// CreateDraftFranchise starts a listing in the Draft status. Nothing is required yet,
+// the rest is filled in with PatchDraftFranchise and UploadDraftFile.
+func CreateDraftFranchise(c *gin.Context, app *config.App) {
+	var req DraftFranchiseRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	franchise := &models.Franchise{
+		ID:        uuid.New(),
+		UserID:    uuid.MustParse(userID),
+		AdPhotos:  []string{},
+		Packages:  []models.FranchisePackage{},
+		Status:    models.FranchiseStatusDraft,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	if _, errs := applyDraftFields(franchise, &req); len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Some fields are invalid", "fields": errs})
+		return
+	}
+
+	err := app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		if _, err := tx.Model(franchise).Insert(); err != nil {
+			return err
+		}
+		if err := saveFranchisePackages(tx, franchise, []string{franchisePackagesColumn}); err != nil {
+			return err
+		}
+		return recordFranchiseRevision(tx, nil, franchise, userID, models.RevisionActionCreate, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save draft: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusCreated, DraftFranchiseResponse{
+		Franchise:    franchise,
+		Completeness: draftCompleteness(app, franchise),
+	})
+}
+
+// GetDraftFranchise returns a draft with its completeness report
+func GetDraftFranchise(c *gin.Context, app *config.App) {
+	franchise, ok := loadOwnDraft(c, app)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, DraftFranchiseResponse{
+		Franchise:    franchise,
+		Completeness: draftCompleteness(app, franchise),
+	})
+}
+
+// PatchDraftFranchise saves the text fields that are sent and leaves the others untouched
+func PatchDraftFranchise(c *gin.Context, app *config.App) {
+	var req DraftFranchiseRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	franchise, ok := loadOwnDraft(c, app)
+	if !ok {
+		return
+	}
+	before := *franchise
+
+	columnsToUpdate, errs := applyDraftFields(franchise, &req)
+	if len(errs) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Some fields are invalid", "fields": errs})
+		return
+	}
+	if !saveDraft(c, app, &before, franchise, columnsToUpdate...) {
+		return
+	}
+
+	c.JSON(http.StatusOK, DraftFranchiseResponse{
+		Franchise:    franchise,
+		Completeness: draftCompleteness(app, franchise),
+	})
+}
+
+// UploadDraftFile stores one file of a draft. A new logo or document replaces the
+// previous one, ad photos are added to the list. Replaced files are kept in storage
+// because earlier revisions still refer to them.
+func UploadDraftFile(c *gin.Context, app *config.App) {
+	field := c.Param("field")
+	if !isDraftFile(field) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file field"})
+		return
+	}
+
+	var req DraftFileRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	franchise, ok := loadOwnDraft(c, app)
+	if !ok {
+		return
+	}
+	before := *franchise
+
+	fileHeader := req.File
+	if field == draftFileLogo || field == draftFileAdPhotos {
+		processBuf, format, err := utils.ImageProcessing(req.File)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Only accept jpg/jpeg/png"})
+			return
+		}
+		fileHeader = utils.BufferToFileHeader(processBuf, req.File.Filename, format)
+	}
+	fileUrl, err := utils.UploadToStorageProxy(fileHeader)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to upload %s", field)})
+		return
+	}
+
+	switch field {
+	case draftFileLogo:
+		franchise.Logo = fileUrl
+	case draftFileAdPhotos:
+		franchise.AdPhotos = append(franchise.AdPhotos[:len(franchise.AdPhotos):len(franchise.AdPhotos)], fileUrl)
+	case draftFileStpw:
+		franchise.Stpw = fileUrl
+	case draftFileNib:
+		franchise.NIB = fileUrl
+	case draftFileNpwp:
+		franchise.NPWP = fileUrl
+	}
+	if !saveDraft(c, app, &before, franchise, field) {
+		_ = utils.DeleteFromStorageProxy(fileUrl)
+		return
+	}
+
+	c.JSON(http.StatusOK, DraftFranchiseResponse{
+		Franchise:    franchise,
+		Completeness: draftCompleteness(app, franchise),
+	})
+}
+
+// DeleteDraftFile removes one file from a draft, the file itself stays in storage for the
+// history. For ad photos the query parameter index selects the photo, without it every
+// photo is removed.
+func DeleteDraftFile(c *gin.Context, app *config.App) {
+	field := c.Param("field")
+	if !isDraftFile(field) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown file field"})
+		return
+	}
+
+	franchise, ok := loadOwnDraft(c, app)
+	if !ok {
+		return
+	}
+	before := *franchise
+
+	switch field {
+	case draftFileLogo:
+		franchise.Logo = ""
+	case draftFileAdPhotos:
+		if indexParam := c.Query("index"); indexParam != "" {
+			index, err := strconv.Atoi(indexParam)
+			if err != nil || index < 0 || index >= len(franchise.AdPhotos) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid ad photo index"})
+				return
+			}
+			franchise.AdPhotos = append(franchise.AdPhotos[:index:index], franchise.AdPhotos[index+1:]...)
+		} else {
+			franchise.AdPhotos = []string{}
+		}
+	case draftFileStpw:
+		franchise.Stpw = ""
+	case draftFileNib:
+		franchise.NIB = ""
+	case draftFileNpwp:
+		franchise.NPWP = ""
+	}
+	if !saveDraft(c, app, &before, franchise, field) {
+		return
+	}
+
+	c.JSON(http.StatusOK, DraftFranchiseResponse{
+		Franchise:    franchise,
+		Completeness: draftCompleteness(app, franchise),
+	})
+}
+
+// DraftFranchiseCompleteness reports which fields and files a draft still lacks
+func DraftFranchiseCompleteness(c *gin.Context, app *config.App) {
+	franchise, ok := loadOwnDraft(c, app)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, draftCompleteness(app, franchise))
+}
+
+// SubmitDraftFranchise sends a complete draft to the verification queue
+func SubmitDraftFranchise(c *gin.Context, app *config.App) {
+	franchise, ok := loadOwnDraft(c, app)
+	if !ok {
+		return
+	}
+
+	completeness := draftCompleteness(app, franchise)
+	if !completeness.Complete {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":  "The draft is incomplete",
+			"fields": completeness.Missing,
+		})
+		return
+	}
+	before := *franchise
+	if fieldErrors := validateFranchiseFields(c.Request.Context(), app, franchise, franchiseFieldColumns); len(fieldErrors) > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid franchise", "fields": fieldErrors})
+		return
+	}
+	franchise.Status = models.FranchiseStatusPending
+	// The website and WhatsApp contact are stored in their normalized form
+	if !saveDraftRevision(c, app, &before, franchise, models.RevisionActionSubmit, "status", "website", "whatsapp_contact") {
+		return
+	}
+
+	c.JSON(http.StatusOK, UploadFranchiseResponse{
+		ID:      franchise.ID.String(),
+		Status:  franchise.Status,
+		Message: "Franchise data has been submitted, waiting for verification.",
+	})
+}
+
+// loadOwnDraft loads the draft of the :id parameter owned by the current user.
+// It answers the request itself when there is no such draft.
+func loadOwnDraft(c *gin.Context, app *config.App) (*models.Franchise, bool) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return nil, false
+	}
+	franchiseID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return nil, false
+	}
+
+	franchise := &models.Franchise{}
+	err = app.DB.Model(franchise).
+		Relation("Packages", orderPackages).
+		Where("franchise.id = ?", franchiseID).
+		Where("franchise.user_id = ?", userID).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Draft not found"})
+		return nil, false
+	}
+	if franchise.Status != models.FranchiseStatusDraft {
+		c.JSON(http.StatusConflict, gin.H{"error": "The franchise has already been submitted, use the edit endpoint instead"})
+		return nil, false
+	}
+	return franchise, true
+}
+
+// saveDraft writes the given columns as an edit, as long as the franchise is still a draft
+func saveDraft(c *gin.Context, app *config.App, before, franchise *models.Franchise, columns ...string) bool {
+	return saveDraftRevision(c, app, before, franchise, models.RevisionActionEdit, columns...)
+}
+
+// saveDraftRevision writes the columns and records the revision. Only a request that still
+// finds the draft writes it, e.g. a repeated submit gets a conflict.
+func saveDraftRevision(c *gin.Context, app *config.App, before, franchise *models.Franchise, action string, columns ...string) bool {
+	franchise.UpdatedAt = time.Now()
+	submitted := false
+	err := app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		res, err := tx.Model(franchise).
+			Column(append(franchiseTableColumns(columns), "updated_at")...).
+			WherePK().
+			Where("user_id = ?", franchise.UserID).
+			Where("status = ?", models.FranchiseStatusDraft).
+			Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			submitted = true
+			return nil
+		}
+		if err := saveFranchisePackages(tx, franchise, columns); err != nil {
+			return err
+		}
+		return recordFranchiseRevision(tx, before, franchise, franchise.UserID.String(), action, nil)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save draft: %v", err)})
+		return false
+	}
+	if submitted {
+		c.JSON(http.StatusConflict, gin.H{"error": "The franchise has already been submitted, use the edit endpoint instead"})
+		return false
+	}
+	return true
+}
+
+// applyDraftFields copies the sent fields into the franchise and returns the changed columns
+func applyDraftFields(franchise *models.Franchise, req *DraftFranchiseRequest) ([]string, []utils.FieldError) {
+	columns := []string{}
+	errs := []utils.FieldError{}
+
+	if req.CategoryID != nil {
+		categoryID := uuid.Nil
+		if value := strings.TrimSpace(*req.CategoryID); value != "" {
+			parsed, err := uuid.Parse(value)
+			if err != nil {
+				errs = append(errs, utils.FieldError{Field: "category_id", Code: "invalid", Message: "Invalid category"})
+			}
+			categoryID = parsed
+		}
+		franchise.CategoryID = categoryID
+		columns = append(columns, "category_id")
+	}
+
+	texts := []struct {
+		column string
+		value  *string
+		target *string
+	}{
+		{"brand", req.Brand, &franchise.Brand},
+		{"description", req.Description, &franchise.Description},
+		{"website", req.Website, &franchise.Website},
+		{"whatsapp_contact", req.WhatsappContact, &franchise.WhatsappContact},
+	}
+	for _, text := range texts {
+		if text.value != nil {
+			*text.target = strings.TrimSpace(*text.value)
+			columns = append(columns, text.column)
+		}
+	}
+
+	numbers := []struct {
+		column string
+		value  *string
+		target *int
+	}{
+		{"investment", req.Investment, &franchise.Investment},
+		{"monthly_revenue", req.MonthlyRevenue, &franchise.MonthlyRevenue},
+		{"roi", req.ROI, &franchise.ROI},
+		{"branch_count", req.BranchCount, &franchise.BranchCount},
+		{"year_founded", req.YearFounded, &franchise.YearFounded},
+	}
+	for _, number := range numbers {
+		if number.value == nil {
+			continue
+		}
+		parsed := 0
+		if value := strings.TrimSpace(*number.value); value != "" {
+			var err error
+			parsed, err = strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				errs = append(errs, utils.FieldError{Field: number.column, Code: "invalid", Message: "Must be a whole number of at least 0"})
+				continue
+			}
+		}
+		*number.target = parsed
+		columns = append(columns, number.column)
+	}
+
+	if req.Packages != nil {
+		packages, packageErrs := parseFranchisePackages(*req.Packages, franchise)
+		if len(packageErrs) > 0 {
+			errs = append(errs, packageErrs...)
+		} else {
+			franchise.Packages = packages
+			columns = append(columns, franchisePackagesColumn)
+		}
+	}
+
+	return columns, errs
+}
+
+// draftCompleteness checks everything UploadFranchise requires, plus every file.
+// Numbers count as missing while they are 0, which is also what an unset field holds.
+func draftCompleteness(app *config.App, franchise *models.Franchise) DraftCompleteness {
+	missing := []utils.FieldError{}
+	require := func(field string, present bool, message string) {
+		if !present {
+			missing = append(missing, utils.FieldError{Field: field, Code: "required", Message: message})
+		}
+	}
+
+	if franchise.CategoryID == uuid.Nil {
+		require("category_id", false, "Choose a category")
+	} else if exists, err := app.DB.Model((*models.Category)(nil)).Where("id = ?", franchise.CategoryID).Exists(); err != nil || !exists {
+		missing = append(missing, utils.FieldError{Field: "category_id", Code: "invalid", Message: "The category does not exist"})
+	}
+	require("brand", franchise.Brand != "", "Enter the brand name")
+	require("description", franchise.Description != "", "Enter a description")
+	require("investment", franchise.Investment > 0, "Enter the investment")
+	require("monthly_revenue", franchise.MonthlyRevenue > 0, "Enter the monthly revenue")
+	require("roi", franchise.ROI > 0, "Enter the return on investment")
+	require("branch_count", franchise.BranchCount > 0, "Enter the number of branches")
+	require("year_founded", franchise.YearFounded > 0, "Enter the year the business was founded")
+	require("website", franchise.Website != "", "Enter the website")
+	require("whatsapp_contact", franchise.WhatsappContact != "", "Enter the WhatsApp contact")
+	require(draftFileLogo, franchise.Logo != "", "Upload a logo")
+	require(draftFileAdPhotos, len(franchise.AdPhotos) > 0, "Upload at least one ad photo")
+	require(draftFileStpw, franchise.Stpw != "", "Upload the STPW document")
+	require(draftFileNib, franchise.NIB != "", "Upload the NIB document")
+	require(draftFileNpwp, franchise.NPWP != "", "Upload the NPWP document")
+
+	const requiredCount = 15
+	return DraftCompleteness{
+		Complete: len(missing) == 0,
+		Percent:  (requiredCount - len(missing)) * 100 / requiredCount,
+		Missing:  missing,
+	}
+}
+
+func isDraftFile(field string) bool {
+	switch field {
+	case draftFileLogo, draftFileAdPhotos, draftFileStpw, draftFileNib, draftFileNpwp:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,507 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+	"github.com/xuri/excelize/v2"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// Import job statuses
+const (
+	FranchiseImportQueued    = "queued"
+	FranchiseImportRunning   = "running"
+	FranchiseImportCompleted = "completed"
+	FranchiseImportFailed    = "failed" // stopped before every row was processed
+)
+
+const (
+	franchiseImportTTL            = 7 * 24 * time.Hour
+	maxFranchiseImportRows        = 500
+	maxFranchiseImportSheetSize   = 5 << 20
+	maxFranchiseImportArchiveSize = 100 << 20
+	maxFranchiseImportFileSize    = 10 << 20 // one file inside the archive
+)
+
+type ImportFranchisesRequest struct {
+	Sheet  *multipart.FileHeader `form:"sheet" binding:"required"` // .csv or .xlsx, the first worksheet is read
+	Images *multipart.FileHeader `form:"images"`                   // .zip with the files named in the sheet
+	Status string                `form:"status"`                   // draft or pending (default)
+}
+
+// FranchiseImportRowResult is the outcome of one sheet row
+type FranchiseImportRowResult struct {
+	Row         int                `json:"row"` // line in the sheet, the header is line 1
+	Brand       string             `json:"brand"`
+	FranchiseID string             `json:"franchise_id,omitempty"`
+	Errors      []utils.FieldError `json:"errors,omitempty"`
+}
+
+// FranchiseImportJob tracks a bulk import. Jobs started over HTTP are kept in Redis for
+// franchiseImportTTL so their progress can be polled.
+type FranchiseImportJob struct {
+	ID            string                     `json:"id"`
+	UserID        string                     `json:"user_id"`
+	Status        string                     `json:"status"`
+	ListingStatus string                     `json:"listing_status"` // status of the created franchises
+	Total         int                        `json:"total"`
+	Processed     int                        `json:"processed"`
+	Created       int                        `json:"created"`
+	Failed        int                        `json:"failed"`
+	Error         string                     `json:"error,omitempty"` // why no row could be imported
+	Rows          []FranchiseImportRowResult `json:"rows"`
+	CreatedAt     time.Time                  `json:"created_at"`
+	FinishedAt    *time.Time                 `json:"finished_at,omitempty"`
+}
+
+// FranchiseImportRow is one sheet row, keyed by the column names of the header
+type FranchiseImportRow struct {
+	Line   int
+	Values map[string]string
+}
+
+func franchiseImportKey(jobID string) string {
+	return fmt.Sprintf("franchise_import:%s", jobID)
+}
+
+// NewFranchiseImportJob prepares a job for rows. listingStatus is "draft" or "pending".
+func NewFranchiseImportJob(userID, listingStatus string, rows []FranchiseImportRow) (*FranchiseImportJob, error) {
+	job := &FranchiseImportJob{
+		ID:        uuid.New().String(),
+		UserID:    userID,
+		Status:    FranchiseImportQueued,
+		Total:     len(rows),
+		Rows:      []FranchiseImportRowResult{},
+		CreatedAt: time.Now(),
+	}
+	switch listingStatus {
+	case "draft":
+		job.ListingStatus = models.FranchiseStatusDraft
+	case "", "pending":
+		job.ListingStatus = models.FranchiseStatusPending
+	default:
+		return nil, fmt.Errorf("status must be draft or pending")
+	}
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("the sheet has no rows")
+	}
+	if len(rows) > maxFranchiseImportRows {
+		return nil, fmt.Errorf("a sheet can have at most %d rows", maxFranchiseImportRows)
+	}
+	return job, nil
+}
+
+// ReadFranchiseImportSheet reads a CSV or XLSX sheet. The first line names the columns,
+// empty lines are skipped.
+func ReadFranchiseImportSheet(filename string, data []byte) ([]FranchiseImportRow, error) {
+	var lines [][]string
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		reader := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV: %v", err)
+		}
+		lines = records
+	case ".xlsx":
+		workbook, err := excelize.OpenReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read XLSX: %v", err)
+		}
+		defer workbook.Close()
+		sheets := workbook.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, fmt.Errorf("the workbook has no worksheet")
+		}
+		records, err := workbook.GetRows(sheets[0])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read XLSX: %v", err)
+		}
+		lines = records
+	default:
+		return nil, fmt.Errorf("the sheet must be a .csv or .xlsx file")
+	}
+
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("the sheet is empty")
+	}
+	header := make([]string, len(lines[0]))
+	for i, name := range lines[0] {
+		header[i] = strings.ReplaceAll(strings.ToLower(strings.TrimSpace(name)), " ", "_")
+	}
+
+	rows := []FranchiseImportRow{}
+	for i, line := range lines[1:] {
+		values := map[string]string{}
+		empty := true
+		for j, value := range line {
+			if j >= len(header) || header[j] == "" {
+				continue
+			}
+			values[header[j]] = strings.TrimSpace(value)
+			if values[header[j]] != "" {
+				empty = false
+			}
+		}
+		if !empty {
+			rows = append(rows, FranchiseImportRow{Line: i + 2, Values: values})
+		}
+	}
+	return rows, nil
+}
+
+// ReadFranchiseImportImages indexes the files of the ZIP archive by lower-case file name,
+// folders inside the archive are ignored
+func ReadFranchiseImportImages(data []byte) (map[string]*zip.File, error) {
+	files := map[string]*zip.File{}
+	if len(data) == 0 {
+		return files, nil
+	}
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ZIP: %v", err)
+	}
+	for _, file := range archive.File {
+		if file.FileInfo().IsDir() || strings.HasPrefix(file.Name, "__MACOSX/") {
+			continue
+		}
+		files[strings.ToLower(path.Base(file.Name))] = file
+	}
+	return files, nil
+}
+
+// RunFranchiseImport creates a franchise for every valid row. A row with errors is skipped
+// and reported, it does not stop the other rows. onProgress is called after every row.
+func RunFranchiseImport(ctx context.Context, app *config.App, job *FranchiseImportJob, rows []FranchiseImportRow, images map[string]*zip.File, onProgress func(*FranchiseImportJob)) {
+	// A panic in one row, e.g. while decoding an image, must not take the API down
+	// or leave the job running forever
+	defer func() {
+		if r := recover(); r != nil {
+			fmt.Printf("Warning: Franchise import %s stopped: %v\n", job.ID, r)
+			now := time.Now()
+			job.Status = FranchiseImportFailed
+			job.Error = fmt.Sprintf("The import stopped unexpectedly after %d of %d rows", job.Processed, job.Total)
+			job.Failed = job.Total - job.Created
+			job.FinishedAt = &now
+			onProgress(job)
+		}
+	}()
+
+	job.Status = FranchiseImportRunning
+	onProgress(job)
+
+	categories := []models.Category{}
+	if err := app.DB.ModelContext(ctx, &categories).Select(); err != nil {
+		now := time.Now()
+		job.Status = FranchiseImportFailed
+		job.Error = fmt.Sprintf("Failed to load categories: %v", err)
+		job.Failed = job.Total
+		job.FinishedAt = &now
+		onProgress(job)
+		return
+	}
+
+	for _, row := range rows {
+		result := FranchiseImportRowResult{Row: row.Line, Brand: row.Values["brand"]}
+		franchiseID, errs := importFranchiseRow(ctx, app, job, row, images, categories)
+		if len(errs) > 0 {
+			result.Errors = errs
+			job.Failed++
+		} else {
+			result.FranchiseID = franchiseID
+			job.Created++
+		}
+		job.Rows = append(job.Rows, result)
+		job.Processed++
+		onProgress(job)
+	}
+
+	now := time.Now()
+	job.Status = FranchiseImportCompleted
+	job.FinishedAt = &now
+	onProgress(job)
+}
+
+// importFranchiseFile is a file of a row, read from the archive and ready to upload
+type importFranchiseFile struct {
+	column string
+	header *multipart.FileHeader
+}
+
+// importFranchiseRow validates one row like UploadFranchise, uploads its files and saves it
+func importFranchiseRow(ctx context.Context, app *config.App, job *FranchiseImportJob, row FranchiseImportRow, images map[string]*zip.File, categories []models.Category) (string, []utils.FieldError) {
+	values := row.Values
+	errs := []utils.FieldError{}
+	// Every text field is required, like on upload
+	for _, column := range franchiseFieldColumns {
+		if values[column] == "" {
+			errs = append(errs, utils.FieldError{Field: column, Code: "required", Message: fmt.Sprintf("%s is required", column)})
+		}
+	}
+
+	franchise := &models.Franchise{
+		ID:        uuid.New(),
+		UserID:    uuid.MustParse(job.UserID),
+		AdPhotos:  []string{},
+		IsBoosted: false,
+		Status:    job.ListingStatus,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	value := func(column string) *string {
+		if values[column] == "" {
+			return nil
+		}
+		v := values[column]
+		return &v
+	}
+	fields := FranchiseFields{
+		Brand:           value("brand"),
+		Description:     value("description"),
+		Investment:      value("investment"),
+		MonthlyRevenue:  value("monthly_revenue"),
+		ROI:             value("roi"),
+		BranchCount:     value("branch_count"),
+		YearFounded:     value("year_founded"),
+		Website:         value("website"),
+		WhatsappContact: value("whatsapp_contact"),
+	}
+
+	// The category may be given by id or by name
+	if name := values["category_id"]; name != "" {
+		found := false
+		for _, category := range categories {
+			if category.ID.String() == strings.ToLower(name) || strings.EqualFold(category.Category, name) {
+				categoryID := category.ID.String()
+				fields.CategoryID = &categoryID
+				found = true
+				break
+			}
+		}
+		if !found {
+			errs = append(errs, utils.FieldError{Field: "category_id", Code: "invalid", Message: "Unknown category"})
+		}
+	}
+
+	_, fieldErrs := applyFranchiseFields(ctx, app, franchise, nil, fields)
+	errs = append(errs, fieldErrs...)
+
+	packages, packageErrs := parseFranchisePackages(values[franchisePackagesColumn], franchise)
+	errs = append(errs, packageErrs...)
+	franchise.Packages = packages
+
+	// Files are named in the sheet and read from the archive, ad photos separated by ";"
+	files := []importFranchiseFile{}
+	fileColumns := []string{draftFileLogo, draftFileAdPhotos, draftFileStpw, draftFileNib, draftFileNpwp}
+	for _, column := range fileColumns {
+		if values[column] == "" {
+			continue
+		}
+		names := []string{values[column]}
+		if column == draftFileAdPhotos {
+			names = strings.Split(values[column], ";")
+		} else if strings.Contains(values[column], ";") {
+			errs = append(errs, utils.FieldError{Field: column, Code: "invalid", Message: fmt.Sprintf("%s takes a single file", column)})
+			continue
+		}
+		for _, name := range names {
+			name = strings.TrimSpace(name)
+			if name == "" {
+				continue
+			}
+			header, err := readFranchiseImportFile(images, name)
+			if err != nil {
+				errs = append(errs, utils.FieldError{Field: column, Code: "invalid", Message: err.Error()})
+				continue
+			}
+			if column == draftFileLogo || column == draftFileAdPhotos {
+				processBuf, format, err := utils.ImageProcessing(header)
+				if err != nil {
+					errs = append(errs, utils.FieldError{Field: column, Code: "invalid", Message: fmt.Sprintf("%s: only accept jpg/jpeg/png", name)})
+					continue
+				}
+				header = utils.BufferToFileHeader(processBuf, name, format)
+			}
+			files = append(files, importFranchiseFile{column: column, header: header})
+		}
+	}
+
+	if len(errs) > 0 {
+		return "", errs
+	}
+
+	uploaded := []string{}
+	removeUploaded := func() {
+		for _, url := range uploaded {
+			_ = utils.DeleteFromStorageProxy(url)
+		}
+	}
+	for _, file := range files {
+		url, err := utils.UploadToStorageProxy(file.header)
+		if err != nil {
+			removeUploaded()
+			return "", []utils.FieldError{{Field: file.column, Code: "upload_failed", Message: fmt.Sprintf("Failed to upload %s", file.header.Filename)}}
+		}
+		uploaded = append(uploaded, url)
+		switch file.column {
+		case draftFileLogo:
+			franchise.Logo = url
+		case draftFileAdPhotos:
+			franchise.AdPhotos = append(franchise.AdPhotos, url)
+		case draftFileStpw:
+			franchise.Stpw = url
+		case draftFileNib:
+			franchise.NIB = url
+		case draftFileNpwp:
+			franchise.NPWP = url
+		}
+	}
+
+	err := app.DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		if _, err := tx.Model(franchise).Insert(); err != nil {
+			return err
+		}
+		if err := saveFranchisePackages(tx, franchise, []string{franchisePackagesColumn}); err != nil {
+			return err
+		}
+		return recordFranchiseRevision(tx, nil, franchise, job.UserID, models.RevisionActionCreate, nil)
+	})
+	if err != nil {
+		removeUploaded()
+		return "", []utils.FieldError{{Field: "row", Code: "save_failed", Message: fmt.Sprintf("Failed to save franchise data: %v", err)}}
+	}
+	return franchise.ID.String(), nil
+}
+
+// readFranchiseImportFile reads a file named in the sheet from the archive
+func readFranchiseImportFile(images map[string]*zip.File, name string) (*multipart.FileHeader, error) {
+	file, ok := images[strings.ToLower(path.Base(name))]
+	if !ok {
+		return nil, fmt.Errorf("%s is not in the images archive", name)
+	}
+	if file.UncompressedSize64 > maxFranchiseImportFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", name, maxFranchiseImportFileSize>>20)
+	}
+	reader, err := file.Open()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	defer reader.Close()
+	data, err := io.ReadAll(io.LimitReader(reader, maxFranchiseImportFileSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", name, err)
+	}
+	if len(data) > maxFranchiseImportFileSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", name, maxFranchiseImportFileSize>>20)
+	}
+	return utils.BufferToFileHeader(bytes.NewBuffer(data), path.Base(file.Name), ""), nil
+}
+
+// readUploadedFile reads a file of the request, up to maxSize bytes
+func readUploadedFile(header *multipart.FileHeader, maxSize int64) ([]byte, error) {
+	if header.Size > maxSize {
+		return nil, fmt.Errorf("%s is larger than %d MB", header.Filename, maxSize>>20)
+	}
+	file, err := header.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return io.ReadAll(file)
+}
+
+// saveFranchiseImportJob stores the job so GetFranchiseImport can report its progress
+func saveFranchiseImportJob(app *config.App, job *FranchiseImportJob) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		fmt.Printf("Warning: Failed to encode import %s: %v\n", job.ID, err)
+		return
+	}
+	if err := app.Redis.Set(context.Background(), franchiseImportKey(job.ID), data, franchiseImportTTL).Err(); err != nil {
+		fmt.Printf("Warning: Failed to save import %s: %v\n", job.ID, err)
+	}
+}
+
+// ImportFranchises starts a bulk import of the user's franchises from a sheet and a ZIP of
+// files. The sheet is checked right away, the rows are imported in the background.
+func ImportFranchises(c *gin.Context, app *config.App) {
+	var req ImportFranchisesRequest
+	if err := c.ShouldBind(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sheetData, err := readUploadedFile(req.Sheet, maxFranchiseImportSheetSize)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	rows, err := ReadFranchiseImportSheet(req.Sheet.Filename, sheetData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The archive is kept in memory, the request's temporary files are gone once the job runs
+	var archiveData []byte
+	if req.Images != nil {
+		archiveData, err = readUploadedFile(req.Images, maxFranchiseImportArchiveSize)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	images, err := ReadFranchiseImportImages(archiveData)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	job, err := NewFranchiseImportJob(c.GetString("user_id"), req.Status, rows)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	saveFranchiseImportJob(app, job)
+	response := *job // the job itself changes in the background
+
+	go RunFranchiseImport(context.Background(), app, job, rows, images, func(job *FranchiseImportJob) {
+		saveFranchiseImportJob(app, job)
+	})
+
+	c.JSON(http.StatusAccepted, response)
+}
+
+// GetFranchiseImport reports the progress of an import and the outcome of every processed row
+func GetFranchiseImport(c *gin.Context, app *config.App) {
+	data, err := app.Redis.Get(context.Background(), franchiseImportKey(c.Param("id"))).Result()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	var job FranchiseImportJob
+	if err := json.Unmarshal([]byte(data), &job); err != nil || job.UserID != c.GetString("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import not found"})
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
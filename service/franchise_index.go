@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/olivere/elastic/v7"
+
+	"github.com/chrisprojs/Franchiso/config"
+)
+
+const (
+	franchiseIndex              = "franchises"
+	franchiseIndexSetupAttempts = 5
+)
+
+// franchiseIndexMapping holds the fields dynamic mapping would get wrong. Everything else,
+// the vectors included, is still mapped on the first write.
+func franchiseIndexMapping() map[string]interface{} {
+	return map[string]interface{}{
+		"properties": map[string]interface{}{
+			"packages": franchisePackagesMapping,
+			"outlets":  franchiseOutletsMapping,
+		},
+	}
+}
+
+// EnsureFranchiseIndex creates the franchises index with its mapping, or adds the mapping to an
+// existing index. Searches on packages and outlets fail without it, so the server must not start
+// when it cannot be applied. Elasticsearch may still be starting, failed requests are retried.
+func EnsureFranchiseIndex(app *config.App) error {
+	var err error
+	for attempt := 1; attempt <= franchiseIndexSetupAttempts; attempt++ {
+		err = ensureFranchiseIndex(context.Background(), app)
+		if err == nil {
+			return nil
+		}
+		if elastic.IsStatusCode(err, 400) {
+			// The index was created by dynamic mapping, e.g. by a restore that ran first:
+			// it has to be deleted and filled again once the server has created it
+			return fmt.Errorf("the %s index has an incompatible mapping, delete it and restore it after the server has started: %v", franchiseIndex, err)
+		}
+		fmt.Printf("Warning: Failed to prepare the %s index (attempt %d of %d): %v\n", franchiseIndex, attempt, franchiseIndexSetupAttempts, err)
+		time.Sleep(time.Duration(attempt) * 2 * time.Second)
+	}
+	return err
+}
+
+func ensureFranchiseIndex(ctx context.Context, app *config.App) error {
+	exists, err := app.ES.IndexExists(franchiseIndex).Do(ctx)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = app.ES.CreateIndex(franchiseIndex).
+			BodyJson(map[string]interface{}{"mappings": franchiseIndexMapping()}).
+			Do(ctx)
+		// Another instance may have created it in the meantime, its mapping is checked below
+		if err == nil || !elastic.IsStatusCode(err, 400) {
+			return err
+		}
+	}
+	_, err = app.ES.PutMapping().Index(franchiseIndex).BodyJson(franchiseIndexMapping()).Do(ctx)
+	return err
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+	"github.com/olivere/elastic/v7"
+
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// franchisePackagesColumn is how the package rows appear in column lists, revisions and change
+// requests. It is not a column of franchiso.franchises, saveFranchisePackages writes it.
+const franchisePackagesColumn = "packages"
+
+const maxFranchisePackages = 10
+
+// FranchisePackageInput is one package of the packages field, a JSON array. A package with
+// the id of an existing one updates it, the packages that are left out are removed.
+type FranchisePackageInput struct {
+	ID             string  `json:"id"`
+	Name           string  `json:"name"`
+	Investment     int     `json:"investment"`
+	FranchiseFee   int     `json:"franchise_fee"`
+	RoyaltyFee     float64 `json:"royalty_fee"`
+	MinArea        int     `json:"min_area"`
+	MonthlyRevenue int     `json:"monthly_revenue"`
+	ROI            int     `json:"roi"`
+}
+
+// orderPackages loads the Packages relation in the order the franchisor gave them
+func orderPackages(q *orm.Query) (*orm.Query, error) {
+	return q.Order("position ASC"), nil
+}
+
+// parseFranchisePackages reads the packages field of an upload or edit. An empty value removes every package.
+func parseFranchisePackages(raw string, franchise *models.Franchise) ([]models.FranchisePackage, []utils.FieldError) {
+	packages := []models.FranchisePackage{}
+	if strings.TrimSpace(raw) == "" {
+		return packages, nil
+	}
+
+	var inputs []FranchisePackageInput
+	if err := json.Unmarshal([]byte(raw), &inputs); err != nil {
+		return nil, []utils.FieldError{{Field: franchisePackagesColumn, Code: "invalid", Message: "Packages must be a JSON array"}}
+	}
+	if len(inputs) > maxFranchisePackages {
+		return nil, []utils.FieldError{{Field: franchisePackagesColumn, Code: "too_many", Message: fmt.Sprintf("A franchise can have at most %d packages", maxFranchisePackages)}}
+	}
+
+	existing := map[string]bool{}
+	for _, pkg := range franchise.Packages {
+		existing[pkg.ID.String()] = true
+	}
+
+	errs := []utils.FieldError{}
+	for i, input := range inputs {
+		field := fmt.Sprintf("packages[%d]", i)
+		name := strings.TrimSpace(input.Name)
+		if name == "" {
+			errs = append(errs, utils.FieldError{Field: field + ".name", Code: "required", Message: "Enter the package name"})
+		}
+		if input.Investment <= 0 {
+			errs = append(errs, utils.FieldError{Field: field + ".investment", Code: "required", Message: "Enter the investment of the package"})
+		}
+		if input.FranchiseFee < 0 || input.FranchiseFee > input.Investment {
+			errs = append(errs, utils.FieldError{Field: field + ".franchise_fee", Code: "invalid", Message: "The franchise fee must be between 0 and the investment"})
+		}
+		if input.RoyaltyFee < 0 || input.RoyaltyFee > 100 {
+			errs = append(errs, utils.FieldError{Field: field + ".royalty_fee", Code: "invalid", Message: "The royalty fee must be a percentage between 0 and 100"})
+		}
+		if input.MinArea < 0 || input.MonthlyRevenue < 0 || input.ROI < 0 {
+			errs = append(errs, utils.FieldError{Field: field, Code: "invalid", Message: "Area, monthly revenue and ROI cannot be negative"})
+		}
+
+		id := uuid.New()
+		if existing[input.ID] {
+			id = uuid.MustParse(input.ID)
+			delete(existing, input.ID) // an id can only be kept once
+		}
+		packages = append(packages, models.FranchisePackage{
+			ID:             id,
+			FranchiseID:    franchise.ID,
+			Name:           name,
+			Investment:     input.Investment,
+			FranchiseFee:   input.FranchiseFee,
+			RoyaltyFee:     input.RoyaltyFee,
+			MinArea:        input.MinArea,
+			MonthlyRevenue: input.MonthlyRevenue,
+			ROI:            input.ROI,
+			Position:       i,
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return packages, nil
+}
+
+// franchiseTableColumns leaves out the columns that are not stored in franchiso.franchises
+func franchiseTableColumns(columns []string) []string {
+	tableColumns := []string{}
+	for _, column := range columns {
+		if column != franchisePackagesColumn {
+			tableColumns = append(tableColumns, column)
+		}
+	}
+	return tableColumns
+}
+
+// saveFranchisePackages replaces the package rows of the franchise when columns contains
+// franchisePackagesColumn
+func saveFranchisePackages(db orm.DB, franchise *models.Franchise, columns []string) error {
+	if !containsString(columns, franchisePackagesColumn) {
+		return nil
+	}
+	_, err := db.Model((*models.FranchisePackage)(nil)).Where("franchise_id = ?", franchise.ID).Delete()
+	if err != nil {
+		return fmt.Errorf("failed to replace packages: %v", err)
+	}
+	if len(franchise.Packages) == 0 {
+		return nil
+	}
+	for i := range franchise.Packages {
+		franchise.Packages[i].FranchiseID = franchise.ID
+	}
+	if _, err := db.Model(&franchise.Packages).Insert(); err != nil {
+		return fmt.Errorf("failed to replace packages: %v", err)
+	}
+	return nil
+}
+
+// franchisePackagesES is the nested packages field of the search document
+func franchisePackagesES(packages []models.FranchisePackage) []models.FranchisePackageES {
+	docs := make([]models.FranchisePackageES, len(packages))
+	for i, pkg := range packages {
+		docs[i] = models.FranchisePackageES{
+			Name:           pkg.Name,
+			Investment:     pkg.Investment,
+			FranchiseFee:   pkg.FranchiseFee,
+			RoyaltyFee:     pkg.RoyaltyFee,
+			MinArea:        pkg.MinArea,
+			MonthlyRevenue: pkg.MonthlyRevenue,
+			ROI:            pkg.ROI,
+		}
+	}
+	return docs
+}
+
+// packageInvestmentFilter matches a franchise whose headline investment, or one of its packages,
+// lies in the range. With maxArea only packages that fit in that area count, in the same package
+// as the investment range.
+func packageInvestmentFilter(minInvestment, maxInvestment, maxArea *int) elastic.Query {
+	investment := func(field string) *elastic.RangeQuery {
+		q := elastic.NewRangeQuery(field)
+		if minInvestment != nil {
+			q.Gte(*minInvestment)
+		}
+		if maxInvestment != nil {
+			q.Lte(*maxInvestment)
+		}
+		return q
+	}
+
+	packageQuery := elastic.NewBoolQuery()
+	if minInvestment != nil || maxInvestment != nil {
+		packageQuery.Filter(investment("packages.investment"))
+	}
+	if maxArea != nil {
+		packageQuery.Filter(elastic.NewRangeQuery("packages.min_area").Lte(*maxArea))
+		return elastic.NewNestedQuery("packages", packageQuery)
+	}
+
+	return elastic.NewBoolQuery().
+		Should(investment("investment")).
+		Should(elastic.NewNestedQuery("packages", packageQuery)).
+		MinimumShouldMatch("1")
+}
+
+// franchisePackagesMapping maps the packages of the franchises index as nested objects,
+// so a filter on several package fields has to match within one package
+var franchisePackagesMapping = map[string]interface{}{
+	"type": "nested",
+	"properties": map[string]interface{}{
+		"name":            map[string]interface{}{"type": "text"},
+		"investment":      map[string]interface{}{"type": "long"},
+		"franchise_fee":   map[string]interface{}{"type": "long"},
+		"royalty_fee":     map[string]interface{}{"type": "float"},
+		"min_area":        map[string]interface{}{"type": "integer"},
+		"monthly_revenue": map[string]interface{}{"type": "long"},
+		"roi":             map[string]interface{}{"type": "integer"},
+	},
+}
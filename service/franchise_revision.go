@@ -0,0 +1,239 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/middleware"
+	"github.com/chrisprojs/Franchiso/models"
+)
+
+// Columns managed by the system, they are neither diffed nor restored
+var franchiseUntrackedColumns = map[string]bool{"is_boosted": true, "created_at": true, "updated_at": true, "deleted_at": true}
+
+// Columns a restore never changes: the listing keeps its owner and its review status
+var franchiseRestoreSkipColumns = map[string]bool{"id": true, "user_id": true, "status": true}
+
+type franchiseField struct {
+	column string
+	index  int
+}
+
+// franchiseTrackedFields are the columns of models.Franchise kept in the history, plus its packages
+var franchiseTrackedFields = func() []franchiseField {
+	fields := []franchiseField{}
+	typ := reflect.TypeOf(models.Franchise{})
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		tag := field.Tag.Get("pg")
+		if !field.IsExported() || tag == "" || tag == "-" || strings.HasPrefix(tag, "rel:has-one") {
+			continue
+		}
+		column := strings.Split(tag, ",")[0]
+		if strings.HasPrefix(tag, "rel:has-many") {
+			// Child rows are versioned with the franchise, under their JSON name
+			column = strings.Split(field.Tag.Get("json"), ",")[0]
+		}
+		if franchiseUntrackedColumns[column] {
+			continue
+		}
+		fields = append(fields, franchiseField{column: column, index: i})
+	}
+	return fields
+}()
+
+type FranchiseRevisionsResponse struct {
+	Revisions []models.FranchiseRevision `json:"revisions"`
+}
+
+// diffFranchise returns the tracked columns that differ, before may be nil for a new franchise
+func diffFranchise(before, after *models.Franchise) map[string]models.FieldChange {
+	changes := map[string]models.FieldChange{}
+	afterValue := reflect.ValueOf(after).Elem()
+	for _, field := range franchiseTrackedFields {
+		newValue := afterValue.Field(field.index).Interface()
+		if before == nil {
+			changes[field.column] = models.FieldChange{Before: nil, After: newValue}
+			continue
+		}
+		oldValue := reflect.ValueOf(before).Elem().Field(field.index).Interface()
+		if !sameColumnValue(oldValue, newValue) {
+			changes[field.column] = models.FieldChange{Before: oldValue, After: newValue}
+		}
+	}
+	return changes
+}
+
+// sameColumnValue compares like the database does, a nil and an empty list are the same
+func sameColumnValue(a, b interface{}) bool {
+	aValue, bValue := reflect.ValueOf(a), reflect.ValueOf(b)
+	if aValue.Kind() == reflect.Slice && bValue.Kind() == reflect.Slice && aValue.Len() == 0 && bValue.Len() == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+// recordFranchiseRevision stores the change from before to after. Pass the transaction
+// that wrote the franchise, so the franchise and its history cannot get out of step.
+// Nothing is stored when no tracked column changed.
+func recordFranchiseRevision(db orm.DB, before, after *models.Franchise, authorID, action string, restoredFrom *uuid.UUID) error {
+	changes := diffFranchise(before, after)
+	if len(changes) == 0 {
+		return nil
+	}
+
+	snapshot := *after
+	snapshot.User = nil
+	snapshot.Category = nil
+	revision := &models.FranchiseRevision{
+		ID:           uuid.New(),
+		FranchiseID:  after.ID,
+		AuthorID:     uuid.MustParse(authorID),
+		Action:       action,
+		Changes:      changes,
+		Snapshot:     &snapshot,
+		RestoredFrom: restoredFrom,
+		CreatedAt:    time.Now(),
+	}
+	if _, err := db.Model(revision).Insert(); err != nil {
+		return fmt.Errorf("failed to record franchise revision: %v", err)
+	}
+	return nil
+}
+
+// ListFranchiseRevisions lists the changes of a franchise, newest first, without the snapshots
+func ListFranchiseRevisions(c *gin.Context, app *config.App) {
+	if _, ok := loadFranchiseForHistory(c, app); !ok {
+		return
+	}
+
+	revisions := []models.FranchiseRevision{}
+	err := app.DB.Model(&revisions).
+		ExcludeColumn("snapshot").
+		Where("franchise_id = ?", c.Param("id")).
+		Order("created_at DESC").
+		Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch revisions"})
+		return
+	}
+	c.JSON(http.StatusOK, FranchiseRevisionsResponse{Revisions: revisions})
+}
+
+// GetFranchiseRevision returns one revision with the franchise as it was after that change
+func GetFranchiseRevision(c *gin.Context, app *config.App) {
+	if _, ok := loadFranchiseForHistory(c, app); !ok {
+		return
+	}
+
+	revision, ok := loadFranchiseRevision(c, app)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, revision)
+}
+
+// RestoreFranchiseRevision puts the content of an earlier revision back. Owner and status
+// stay as they are, and the restore is recorded as a new revision.
+func RestoreFranchiseRevision(c *gin.Context, app *config.App) {
+	revision, ok := loadFranchiseRevision(c, app)
+	if !ok {
+		return
+	}
+
+	franchise := &models.Franchise{}
+	err := app.DB.Model(franchise).
+		Relation("Packages", orderPackages).
+		Where("id = ?", revision.FranchiseID).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		return
+	}
+	before := *franchise
+
+	columnsToUpdate := []string{}
+	target := reflect.ValueOf(franchise).Elem()
+	source := reflect.ValueOf(revision.Snapshot).Elem()
+	for _, field := range franchiseTrackedFields {
+		if franchiseRestoreSkipColumns[field.column] {
+			continue
+		}
+		value := source.Field(field.index)
+		if !sameColumnValue(target.Field(field.index).Interface(), value.Interface()) {
+			target.Field(field.index).Set(value)
+			columnsToUpdate = append(columnsToUpdate, field.column)
+		}
+	}
+	if len(columnsToUpdate) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "The franchise already matches this revision"})
+		return
+	}
+	franchise.UpdatedAt = time.Now()
+
+	err = app.DB.RunInTransaction(context.Background(), func(tx *pg.Tx) error {
+		_, err := tx.Model(franchise).
+			Column(append(franchiseTableColumns(columnsToUpdate), "updated_at")...).
+			WherePK().
+			Update()
+		if err != nil {
+			return err
+		}
+		if err := saveFranchisePackages(tx, franchise, columnsToUpdate); err != nil {
+			return err
+		}
+		return recordFranchiseRevision(tx, &before, franchise, c.GetString("user_id"), models.RevisionActionRestore, &revision.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to restore revision: %v", err)})
+		return
+	}
+
+	if franchise.Status == models.FranchiseStatusVerified {
+		if err := indexFranchiseToES(app, franchise); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Revision restored successfully", "franchise": franchise})
+}
+
+// loadFranchiseForHistory loads the franchise of the :id parameter when the user owns it
+// or may see private data of any listing
+func loadFranchiseForHistory(c *gin.Context, app *config.App) (*models.Franchise, bool) {
+	franchise := &models.Franchise{}
+	if err := app.DB.Model(franchise).Where("id = ?", c.Param("id")).Select(); err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		return nil, false
+	}
+	if c.GetString("user_id") != franchise.UserID.String() && !middleware.HasPermission(app, c.GetString("role"), models.PermFranchiseViewPrivate) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return franchise, true
+}
+
+// loadFranchiseRevision loads the :revision_id revision of the :id franchise
+func loadFranchiseRevision(c *gin.Context, app *config.App) (*models.FranchiseRevision, bool) {
+	revision := &models.FranchiseRevision{}
+	err := app.DB.Model(revision).
+		Where("id = ?", c.Param("revision_id")).
+		Where("franchise_id = ?", c.Param("id")).
+		Select()
+	if err != nil || revision.Snapshot == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Revision not found"})
+		return nil, false
+	}
+	return revision, true
+}
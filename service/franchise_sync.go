@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/olivere/elastic/v7"
+	"google.golang.org/genai"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// indexFranchiseToES writes the full search document of a verified franchise.
+// The User, Category and Packages relations are loaded when they are missing, the outlets always.
+func indexFranchiseToES(app *config.App, franchise *models.Franchise) error {
+	if franchise.User == nil {
+		var user models.User
+		if err := app.DB.Model(&user).Where("id = ?", franchise.UserID).Select(); err == nil {
+			franchise.User = &user
+		}
+	}
+	if franchise.Category == nil {
+		var category models.Category
+		if err := app.DB.Model(&category).Where("id = ?", franchise.CategoryID).Select(); err == nil {
+			franchise.Category = &category
+		}
+	}
+
+	if franchise.Packages == nil {
+		err := app.DB.Model(&franchise.Packages).
+			Where("franchise_id = ?", franchise.ID).
+			Order("position ASC").
+			Select()
+		if err != nil {
+			return fmt.Errorf("failed to load packages: %v", err)
+		}
+	}
+
+	outlets, err := loadFranchiseOutlets(app.DB, franchise.ID)
+	if err != nil {
+		return err
+	}
+
+	var user models.User
+	if franchise.User != nil {
+		user = *franchise.User
+	}
+	var category models.Category
+	if franchise.Category != nil {
+		category = *franchise.Category
+	}
+
+	// Convert logo and ad_photos to VectorizedImage structure
+	logoVectorized, err := utils.ConvertToVectorizedImage(franchise.Logo)
+	if err != nil {
+		return err
+	}
+	adPhotosVectorized, err := utils.ConvertToVectorizedImages(franchise.AdPhotos)
+	if err != nil {
+		return err
+	}
+
+	// Convert ad_photos to []map[string]interface{} to ensure object structure in Elasticsearch
+	adPhotosMaps := make([]map[string]interface{}, len(adPhotosVectorized))
+	for i, img := range adPhotosVectorized {
+		adPhotosMaps[i] = map[string]interface{}{
+			"file_path": img.FilePath,
+			"vector":    img.Vector,
+		}
+	}
+
+	doc := map[string]interface{}{
+		"id": franchise.ID.String(),
+		"user": map[string]interface{}{
+			"user_id": franchise.UserID.String(),
+			"name":    user.Name,
+		},
+		"category": map[string]interface{}{
+			"category_id": franchise.CategoryID.String(),
+			"category":    category.Category,
+		},
+		"brand": franchise.Brand,
+		"logo": map[string]interface{}{
+			"file_path": logoVectorized.FilePath,
+			"vector":    logoVectorized.Vector,
+		},
+		"ad_photos":        adPhotosMaps,
+		"description":      franchise.Description,
+		"investment":       franchise.Investment,
+		"monthly_revenue":  franchise.MonthlyRevenue,
+		"roi":              franchise.ROI,
+		"branch_count":     franchise.BranchCount,
+		"year_founded":     franchise.YearFounded,
+		"website":          franchise.Website,
+		"whatsapp_contact": franchise.WhatsappContact,
+		"is_boosted":       franchise.IsBoosted,
+		"packages":         franchisePackagesES(franchise.Packages),
+		"outlets":          franchiseOutletsES(outlets),
+		"created_at":       franchise.CreatedAt,
+		"updated_at":       franchise.UpdatedAt,
+	}
+
+	// Generate text embedding if franchise is boosted
+	if franchise.IsBoosted && os.Getenv("GEMINI_ACTIVE") == "true" && app.Gemini != nil {
+		textForEmbedding := franchise.Brand + " " + franchise.Description
+		embeddingRes, err := app.Gemini.Models.EmbedContent(context.Background(), "text-embedding-004", genai.Text(textForEmbedding), nil)
+		if err != nil {
+			return fmt.Errorf("failed to generate embedding: %v", err)
+		}
+		if len(embeddingRes.Embeddings) > 0 {
+			// Convert []float32 to []float64 for Elasticsearch
+			textVector := make([]float64, len(embeddingRes.Embeddings[0].Values))
+			for i, v := range embeddingRes.Embeddings[0].Values {
+				textVector[i] = float64(v)
+			}
+			doc["text_vector"] = textVector
+		}
+	}
+
+	_, err = app.ES.Index().
+		Index("franchises").
+		Id(franchise.ID.String()).
+		BodyJson(doc).
+		Refresh("true").
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to synchronize to Elasticsearch: %v", err)
+	}
+	return nil
+}
+
+// deleteFranchiseFromES removes the search document, a missing document is not an error
+func deleteFranchiseFromES(app *config.App, franchiseID string) error {
+	_, err := app.ES.Delete().
+		Index("franchises").
+		Id(franchiseID).
+		Refresh("true").
+		Do(context.Background())
+	if esErr, ok := err.(*elastic.Error); ok && esErr.Status == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,202 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// minYearFounded is the earliest founding year accepted for a franchise
+const minYearFounded = 1900
+
+// franchiseFieldColumns are the text fields of a franchise checked by validateFranchiseFields
+var franchiseFieldColumns = []string{
+	"category_id", "brand", "description", "investment", "monthly_revenue",
+	"roi", "branch_count", "year_founded", "website", "whatsapp_contact",
+}
+
+// FranchiseFields holds the text fields of an upload, an edit or an import row, nil when not sent
+type FranchiseFields struct {
+	CategoryID      *string
+	Brand           *string
+	Description     *string
+	Investment      *string
+	MonthlyRevenue  *string
+	ROI             *string
+	BranchCount     *string
+	YearFounded     *string
+	Website         *string
+	WhatsappContact *string
+}
+
+// applyFranchiseFields sets the sent fields on the franchise and validates the ones that differ
+// from before, nil for a new franchise. It returns the changed columns, or every rejected field.
+func applyFranchiseFields(ctx context.Context, app *config.App, franchise, before *models.Franchise, fields FranchiseFields) ([]string, []utils.FieldError) {
+	sent, errs := parseFranchiseFields(franchise, fields)
+	changed := changedFranchiseColumns(before, franchise, sent)
+	errs = append(errs, validateFranchiseFields(ctx, app, franchise, changed)...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	// Normalizing may turn a sent value back into the stored one
+	return changedFranchiseColumns(before, franchise, changed), nil
+}
+
+// parseFranchiseFields sets the sent fields on the franchise and returns their columns.
+// Fields that cannot be parsed are reported and left out.
+func parseFranchiseFields(franchise *models.Franchise, fields FranchiseFields) ([]string, []utils.FieldError) {
+	columns := []string{}
+	errs := []utils.FieldError{}
+
+	if fields.CategoryID != nil {
+		categoryID, err := uuid.Parse(strings.TrimSpace(*fields.CategoryID))
+		if err != nil {
+			errs = append(errs, utils.FieldError{Field: "category_id", Code: "invalid", Message: "Invalid category"})
+		} else {
+			franchise.CategoryID = categoryID
+			columns = append(columns, "category_id")
+		}
+	}
+
+	texts := []struct {
+		column string
+		value  *string
+		target *string
+	}{
+		{"brand", fields.Brand, &franchise.Brand},
+		{"description", fields.Description, &franchise.Description},
+		{"website", fields.Website, &franchise.Website},
+		{"whatsapp_contact", fields.WhatsappContact, &franchise.WhatsappContact},
+	}
+	for _, text := range texts {
+		if text.value != nil {
+			*text.target = strings.TrimSpace(*text.value)
+			columns = append(columns, text.column)
+		}
+	}
+
+	numbers := []struct {
+		column string
+		value  *string
+		target *int
+	}{
+		{"investment", fields.Investment, &franchise.Investment},
+		{"monthly_revenue", fields.MonthlyRevenue, &franchise.MonthlyRevenue},
+		{"roi", fields.ROI, &franchise.ROI},
+		{"branch_count", fields.BranchCount, &franchise.BranchCount},
+		{"year_founded", fields.YearFounded, &franchise.YearFounded},
+	}
+	for _, number := range numbers {
+		if number.value == nil {
+			continue
+		}
+		parsed, err := strconv.Atoi(strings.TrimSpace(*number.value))
+		if err != nil {
+			errs = append(errs, utils.FieldError{Field: number.column, Code: "invalid", Message: "Must be a whole number"})
+			continue
+		}
+		*number.target = parsed
+		columns = append(columns, number.column)
+	}
+
+	return columns, errs
+}
+
+// validateFranchiseFields checks the given columns of the franchise, normalizing its website and
+// WhatsApp contact in place. The figures are also checked against each other when one of them is given.
+func validateFranchiseFields(ctx context.Context, app *config.App, franchise *models.Franchise, columns []string) []utils.FieldError {
+	errs := []utils.FieldError{}
+	reject := func(field, code, message string) {
+		errs = append(errs, utils.FieldError{Field: field, Code: code, Message: message})
+	}
+
+	checkFigures := false
+	for _, column := range columns {
+		switch column {
+		case "category_id":
+			if franchise.CategoryID == uuid.Nil {
+				reject(column, "required", "Choose a category")
+			} else if exists, err := app.DB.Model((*models.Category)(nil)).Where("id = ?", franchise.CategoryID).Exists(); err != nil || !exists {
+				reject(column, "invalid", "The category does not exist")
+			}
+		case "brand":
+			if franchise.Brand == "" {
+				reject(column, "required", "Enter the brand name")
+			}
+		case "description":
+			if franchise.Description == "" {
+				reject(column, "required", "Enter a description")
+			}
+		case "investment":
+			checkFigures = true
+			if franchise.Investment <= 0 {
+				reject(column, "out_of_range", "The investment must be more than 0")
+			}
+		case "monthly_revenue":
+			checkFigures = true
+			if franchise.MonthlyRevenue < 0 {
+				reject(column, "out_of_range", "The monthly revenue cannot be negative")
+			}
+		case "roi":
+			if franchise.ROI < 0 {
+				reject(column, "implausible", "The return on investment cannot be negative")
+			}
+		case "branch_count":
+			if franchise.BranchCount < 0 {
+				reject(column, "out_of_range", "The number of branches cannot be negative")
+			}
+		case "year_founded":
+			if currentYear := time.Now().Year(); franchise.YearFounded < minYearFounded || franchise.YearFounded > currentYear {
+				reject(column, "out_of_range", fmt.Sprintf("The year founded must be between %d and %d", minYearFounded, currentYear))
+			}
+		case "website":
+			website, err := utils.NormalizeWebsiteURL(franchise.Website)
+			if err != nil {
+				reject(column, "invalid", err.Error())
+				continue
+			}
+			franchise.Website = website
+			if app.WebsiteChecker != nil {
+				if err := app.WebsiteChecker.CheckWebsite(ctx, website); err != nil {
+					reject(column, "unreachable", "The website cannot be reached, check the address")
+				}
+			}
+		case "whatsapp_contact":
+			number, err := utils.NormalizeWhatsappNumber(franchise.WhatsappContact)
+			if err != nil {
+				reject(column, "invalid", err.Error())
+				continue
+			}
+			franchise.WhatsappContact = number
+		}
+	}
+
+	// Earning back more than the whole investment within one month is not plausible
+	if checkFigures && franchise.Investment > 0 && franchise.MonthlyRevenue > franchise.Investment {
+		reject("monthly_revenue", "implausible", "The monthly revenue is higher than the investment, check both figures")
+	}
+	return errs
+}
+
+// changedFranchiseColumns keeps the columns whose value differs from before, all of them for a new franchise
+func changedFranchiseColumns(before, franchise *models.Franchise, columns []string) []string {
+	if before == nil {
+		return columns
+	}
+	changes := diffFranchise(before, franchise)
+	changed := []string{}
+	for _, column := range columns {
+		if _, ok := changes[column]; ok {
+			changed = append(changed, column)
+		}
+	}
+	return changed
+}
@@ -181,6 +181,28 @@ func IsCoordinateInProvince(lat, lng float64, province *IndonesiaProvince) bool
 	return false
 }
 
+// FindProvinceByCoordinate returns the province that contains the coordinate, or nil
+func FindProvinceByCoordinate(lat, lng float64) *IndonesiaProvince {
+	// Lazy loading: load provinces data if not already loaded
+	if provincesData == nil {
+		if err := LoadProvincesData(); err != nil {
+			return nil
+		}
+	}
+
+	for i := range provincesData.Features {
+		province := &provincesData.Features[i]
+		minLat, minLng, maxLat, maxLng, err := GetProvinceBoundaries(province)
+		if err != nil {
+			continue
+		}
+		if IsCoordinateInProvinceOptimized(lat, lng, province, minLat, minLng, maxLat, maxLng) {
+			return province
+		}
+	}
+	return nil
+}
+
 // GetProvinceBoundaries returns the bounding box of a province with caching
 func GetProvinceBoundaries(province *IndonesiaProvince) (minLat, minLng, maxLat, maxLng float64, err error) {
 	if province == nil {
@@ -321,7 +343,8 @@ func executeQuery(query string, location string, radius int, apiKey, baseURL str
 	return &result, nil
 }
 
-// GetFranchiseLocations fetches franchise locations by brand name using Google Maps Places API
+// GetFranchiseLocations fetches franchise locations by brand name using Google Maps Places API.
+// With franchise_id the registered outlets of that franchise are returned when it has any.
 func GetFranchiseLocations(c *gin.Context, app *config.App) {
 	brandName := strings.TrimSpace(c.Query("brand"))
 	province := strings.TrimSpace(c.Query("province"))
@@ -332,6 +355,26 @@ func GetFranchiseLocations(c *gin.Context, app *config.App) {
 	fmt.Printf("DEBUG: Google Maps Base URL: %s\n", app.GoogleMaps.BaseURL)
 	fmt.Printf("DEBUG: Starting GetFranchiseLocations function\n")
 
+	// Registered outlets of the franchise take precedence over a Google Maps search
+	if franchiseID := strings.TrimSpace(c.Query("franchise_id")); franchiseID != "" {
+		var provinceData *IndonesiaProvince
+		if province != "" {
+			if provinceData = FindProvinceByName(province); provinceData == nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Province not found"})
+				return
+			}
+		}
+		registered, err := registeredOutletLocations(app, franchiseID, provinceData)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if registered != nil {
+			c.JSON(http.StatusOK, registered)
+			return
+		}
+	}
+
 	// Validate input
 	if brandName == "" {
 		c.JSON(http.StatusBadRequest, gin.H{
@@ -0,0 +1,22 @@
+package service
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// JWKS publishes the public keys our tokens can be verified with, so other services
+// don't need a shared secret
+func JWKS(c *gin.Context) {
+	set, err := utils.PublicJWKS()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load signing keys"})
+		return
+	}
+	// verifiers refetch on an unknown kid, so a short cache is enough to pick up rotations
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, set)
+}
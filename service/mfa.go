@@ -0,0 +1,548 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const (
+	mfaIssuer            = "Franchiso"
+	mfaRecoveryCodeCount = 10
+	mfaMaxAttempts       = 5
+)
+
+type MFAChallengeResponse struct {
+	MFARequired           bool   `json:"mfa_required"`
+	MFAEnrollmentRequired bool   `json:"mfa_enrollment_required"`
+	MFAToken              string `json:"mfa_token"`
+}
+
+type EnrollMFAResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type EnableMFARequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type EnableMFAResponse struct {
+	RecoveryCodes []string      `json:"recovery_codes"`
+	AccessToken   string        `json:"access_token,omitempty"`
+	RefreshToken  string        `json:"refresh_token,omitempty"`
+	CSRFToken     string        `json:"csrf_token,omitempty"`
+	User          *UserResponse `json:"user,omitempty"`
+}
+
+type VerifyMFALoginRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+type DisableMFARequest struct {
+	Code     string `json:"code" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RegenerateRecoveryCodesRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type UpdateMFAPolicyRequest struct {
+	Required *bool `json:"required" binding:"required"`
+}
+
+type ListMFAPoliciesResponse struct {
+	Policies []models.MFARolePolicy `json:"policies"`
+}
+
+// completeLogin finishes a login whose first factor has been checked. It either
+// issues the session, or returns an mfa_pending token when two-factor authentication
+// is enabled for the user or mandatory for their role.
+func completeLogin(c *gin.Context, app *config.App, user *models.User) {
+	if user.DeletionRequestedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{
+			"error":          "Account is scheduled for deletion. Use POST /profile/restore to cancel the deletion",
+			"permanent_from": user.DeletionRequestedAt.Add(AccountDeletionGracePeriod),
+		})
+		return
+	}
+
+	mfa, err := loadUserMFA(app, user.ID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	enabled := mfa != nil && mfa.Enabled
+
+	if enabled || isMFARequiredForRole(app, user.Role) {
+		mfaToken, err := utils.GenerateJWT(user.ID.String(), user.Role, "", "mfa_pending")
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate two-factor token: %v", err)})
+			return
+		}
+		c.JSON(http.StatusOK, MFAChallengeResponse{
+			MFARequired:           true,
+			MFAEnrollmentRequired: !enabled,
+			MFAToken:              mfaToken,
+		})
+		return
+	}
+
+	accessToken, refreshToken, err := issueSession(c, app, user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	tokens, err := deliverTokens(c, app, isBrowserMode(c), accessToken, refreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set session cookies"})
+		return
+	}
+
+	resp := LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		CSRFToken:    tokens.CSRFToken,
+		User: UserResponse{
+			ID:    user.ID.String(),
+			Name:  user.Name,
+			Email: user.Email,
+			Role:  user.Role,
+		},
+	}
+	c.JSON(http.StatusOK, resp)
+}
+
+// loadUserMFA returns the user's two-factor settings, nil when never enrolled
+func loadUserMFA(app *config.App, userID string) (*models.UserMFA, error) {
+	mfa := &models.UserMFA{}
+	err := app.DB.Model(mfa).Where("user_id = ?", userID).Select()
+	if err == pg.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return mfa, nil
+}
+
+func isMFARequiredForRole(app *config.App, role string) bool {
+	var policy models.MFARolePolicy
+	err := app.DB.Model(&policy).Where("role = ?", role).Select()
+	return err == nil && policy.Required
+}
+
+// checkTOTPCode validates a TOTP code and rejects a code that has already been used
+func checkTOTPCode(app *config.App, userID string, secret string, code string) bool {
+	step, ok := utils.ValidateTOTP(secret, code, time.Now())
+	if !ok {
+		return false
+	}
+	usedKey := fmt.Sprintf("mfa_used_step:%s:%d", userID, step)
+	firstUse, err := app.Redis.SetNX(context.Background(), usedKey, "1", 2*time.Minute).Result()
+	return err == nil && firstUse
+}
+
+func hashRecoveryCodes(codes []string) []string {
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return hashes
+}
+
+// EnrollMFA generates a new TOTP secret; it only becomes active after EnableMFA
+func EnrollMFA(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	mfa, err := loadUserMFA(app, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	if mfa != nil && mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate two-factor secret"})
+		return
+	}
+
+	enrollment := models.UserMFA{
+		UserID:    user.ID,
+		Secret:    secret,
+		Enabled:   false,
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	_, err = app.DB.Model(&enrollment).
+		OnConflict("(user_id) DO UPDATE").
+		Set("secret = EXCLUDED.secret").
+		Set("enabled = EXCLUDED.enabled").
+		Set("updated_at = EXCLUDED.updated_at").
+		Insert()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save two-factor secret: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, EnrollMFAResponse{
+		Secret:          secret,
+		ProvisioningURI: utils.TOTPProvisioningURI(secret, user.Email, mfaIssuer),
+	})
+}
+
+// EnableMFA confirms the enrollment with a first code and returns the recovery codes.
+// When called during login (mfa_pending token) it also issues the session.
+func EnableMFA(c *gin.Context, app *config.App) {
+	var req EnableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	mfa, err := loadUserMFA(app, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	if mfa == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Please enroll two-factor authentication first"})
+		return
+	}
+	if mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	if !consumeMFAAttempt(c, app) {
+		return
+	}
+	if !checkTOTPCode(app, userID, mfa.Secret, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect two-factor code"})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(mfaRecoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+
+	now := time.Now()
+	mfa.Enabled = true
+	mfa.EnabledAt = &now
+	mfa.RecoveryCodeHashes = hashRecoveryCodes(recoveryCodes)
+	mfa.UpdatedAt = now
+	_, err = app.DB.Model(mfa).
+		Column("enabled", "enabled_at", "recovery_code_hashes", "updated_at").
+		WherePK().
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to enable two-factor authentication"})
+		return
+	}
+
+	resp := EnableMFAResponse{RecoveryCodes: recoveryCodes}
+
+	// Enrollment forced during login, the second factor is now proven
+	if c.GetBool("mfa_pending") {
+		var user models.User
+		err = app.DB.Model(&user).Where("id = ?", userID).Select()
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		tokens, err := finishMFALogin(c, app, &user)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		resp.AccessToken = tokens.AccessToken
+		resp.RefreshToken = tokens.RefreshToken
+		resp.CSRFToken = tokens.CSRFToken
+		resp.User = &UserResponse{
+			ID:    user.ID.String(),
+			Name:  user.Name,
+			Email: user.Email,
+			Role:  user.Role,
+		}
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// VerifyMFALogin is the second login step: a TOTP code or one of the recovery codes
+func VerifyMFALogin(c *gin.Context, app *config.App) {
+	var req VerifyMFALoginRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Code == "" && req.RecoveryCode == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "code or recovery_code is required"})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	mfa, err := loadUserMFA(app, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication must be enrolled first"})
+		return
+	}
+
+	if !consumeMFAAttempt(c, app) {
+		return
+	}
+
+	if req.RecoveryCode != "" {
+		hash := utils.HashToken(strings.ToLower(strings.TrimSpace(req.RecoveryCode)))
+		// Recovery codes are single-use. The code is removed only while it is still stored,
+		// so of two requests with the same code only one succeeds.
+		res, err := app.DB.Model((*models.UserMFA)(nil)).
+			Set("recovery_code_hashes = array_remove(recovery_code_hashes, ?)", hash).
+			Set("updated_at = ?", time.Now()).
+			Where("user_id = ?", userID).
+			Where("? = ANY(recovery_code_hashes)", hash).
+			Update()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update recovery codes"})
+			return
+		}
+		if res.RowsAffected() == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect recovery code"})
+			return
+		}
+	} else if !checkTOTPCode(app, userID, mfa.Secret, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect two-factor code"})
+		return
+	}
+
+	var user models.User
+	err = app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	tokens, err := finishMFALogin(c, app, &user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, LoginResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		CSRFToken:    tokens.CSRFToken,
+		User: UserResponse{
+			ID:    user.ID.String(),
+			Name:  user.Name,
+			Email: user.Email,
+			Role:  user.Role,
+		},
+	})
+}
+
+// finishMFALogin burns the mfa_pending token and issues the real session
+func finishMFALogin(c *gin.Context, app *config.App, user *models.User) (sessionTokens, error) {
+	if expiresAt, ok := c.Get("token_expires_at"); ok {
+		utils.DenylistToken(context.Background(), app.Redis, c.GetString("token_id"), expiresAt.(time.Time))
+	}
+	accessToken, refreshToken, err := issueSession(c, app, user)
+	if err != nil {
+		return sessionTokens{}, err
+	}
+	return deliverTokens(c, app, isBrowserMode(c), accessToken, refreshToken)
+}
+
+// consumeMFAAttempt limits the number of codes that can be tried with one mfa_pending token
+func consumeMFAAttempt(c *gin.Context, app *config.App) bool {
+	if !c.GetBool("mfa_pending") {
+		return true
+	}
+
+	ctx := context.Background()
+	attemptKey := fmt.Sprintf("mfa_attempt:%s", c.GetString("token_id"))
+	attempts, err := app.Redis.Incr(ctx, attemptKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process two-factor attempt"})
+		return false
+	}
+	if attempts == 1 {
+		app.Redis.Expire(ctx, attemptKey, utils.MFAPendingTokenTTL)
+	}
+	if attempts > mfaMaxAttempts {
+		if expiresAt, ok := c.Get("token_expires_at"); ok {
+			utils.DenylistToken(ctx, app.Redis, c.GetString("token_id"), expiresAt.(time.Time))
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Too many incorrect two-factor codes. Please login again"})
+		return false
+	}
+	return true
+}
+
+// DisableMFA turns two-factor authentication off, unless it is mandatory for the role
+func DisableMFA(c *gin.Context, app *config.App) {
+	var req DisableMFARequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	if isMFARequiredForRole(app, c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Two-factor authentication is mandatory for your role"})
+		return
+	}
+
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	if ok, _, _ := utils.VerifyPassword(user.PasswordHash, req.Password); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	mfa, err := loadUserMFA(app, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !checkTOTPCode(app, userID, mfa.Secret, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect two-factor code"})
+		return
+	}
+
+	_, err = app.DB.Model((*models.UserMFA)(nil)).Where("user_id = ?", userID).Delete()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two-factor authentication"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication has been disabled"})
+}
+
+// RegenerateRecoveryCodes replaces all recovery codes, e.g. after they ran out
+func RegenerateRecoveryCodes(c *gin.Context, app *config.App) {
+	var req RegenerateRecoveryCodesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	mfa, err := loadUserMFA(app, userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load two-factor settings"})
+		return
+	}
+	if mfa == nil || !mfa.Enabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+	if !checkTOTPCode(app, userID, mfa.Secret, req.Code) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Incorrect two-factor code"})
+		return
+	}
+
+	recoveryCodes, err := utils.GenerateRecoveryCodes(mfaRecoveryCodeCount)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+		return
+	}
+	_, err = app.DB.Model((*models.UserMFA)(nil)).
+		Set("recovery_code_hashes = ?", pg.Array(hashRecoveryCodes(recoveryCodes))).
+		Set("updated_at = ?", time.Now()).
+		Where("user_id = ?", userID).
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save recovery codes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": recoveryCodes})
+}
+
+// ListMFAPolicies displays the roles for which two-factor authentication is configured
+func ListMFAPolicies(c *gin.Context, app *config.App) {
+	var policies []models.MFARolePolicy
+	err := app.DB.Model(&policies).Order("role ASC").Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch two-factor policies"})
+		return
+	}
+	if policies == nil {
+		policies = []models.MFARolePolicy{}
+	}
+	c.JSON(http.StatusOK, ListMFAPoliciesResponse{Policies: policies})
+}
+
+// UpdateMFAPolicy makes two-factor authentication mandatory (or optional again) for a role
+func UpdateMFAPolicy(c *gin.Context, app *config.App) {
+	roleName := c.Param("role")
+	var req UpdateMFAPolicyRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	exists, err := app.DB.Model((*models.Role)(nil)).Where("name = ?", roleName).Exists()
+	if err != nil || !exists {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	policy := models.MFARolePolicy{
+		Role:      roleName,
+		Required:  *req.Required,
+		UpdatedBy: uuid.MustParse(c.GetString("user_id")),
+		UpdatedAt: time.Now(),
+	}
+	_, err = app.DB.Model(&policy).
+		OnConflict("(role) DO UPDATE").
+		Set("required = EXCLUDED.required").
+		Set("updated_by = EXCLUDED.updated_by").
+		Set("updated_at = EXCLUDED.updated_at").
+		Insert()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update two-factor policy: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
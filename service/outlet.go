@@ -0,0 +1,350 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10/orm"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const maxFranchiseOutlets = 1000
+
+// franchiseOutletsMapping maps the outlets of the franchises index, location as a geo point
+// for the distance filter of SearchingFranchise
+var franchiseOutletsMapping = map[string]interface{}{
+	"properties": map[string]interface{}{
+		"id":       map[string]interface{}{"type": "keyword"},
+		"name":     map[string]interface{}{"type": "text"},
+		"province": map[string]interface{}{"type": "keyword"},
+		"type":     map[string]interface{}{"type": "keyword"},
+		"location": map[string]interface{}{"type": "geo_point"},
+	},
+}
+
+// OutletRequest creates an outlet or replaces all of its fields
+type OutletRequest struct {
+	Name      string   `json:"name"`
+	Address   string   `json:"address"`
+	Latitude  *float64 `json:"latitude"`
+	Longitude *float64 `json:"longitude"`
+	Province  string   `json:"province"` // optional, taken from the coordinates when empty
+	Type      string   `json:"type"`
+	OpenedAt  string   `json:"opened_at"` // optional, YYYY-MM-DD
+}
+
+type OutletsResponse struct {
+	Outlets []models.Outlet `json:"outlets"`
+}
+
+// applyOutletRequest validates req and copies it onto outlet
+func applyOutletRequest(req *OutletRequest, outlet *models.Outlet) []utils.FieldError {
+	errs := []utils.FieldError{}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		errs = append(errs, utils.FieldError{Field: "name", Code: "required", Message: "Enter the outlet name"})
+	}
+	address := strings.TrimSpace(req.Address)
+	if address == "" {
+		errs = append(errs, utils.FieldError{Field: "address", Code: "required", Message: "Enter the outlet address"})
+	}
+	if req.Type != models.OutletTypeCompanyOwned && req.Type != models.OutletTypeFranchised {
+		errs = append(errs, utils.FieldError{Field: "type", Code: "invalid", Message: fmt.Sprintf("Type must be %s or %s", models.OutletTypeCompanyOwned, models.OutletTypeFranchised)})
+	}
+
+	var openedAt *time.Time
+	if req.OpenedAt != "" {
+		date, err := time.Parse("2006-01-02", req.OpenedAt)
+		if err != nil {
+			errs = append(errs, utils.FieldError{Field: "opened_at", Code: "invalid", Message: "Opening date must be in the format YYYY-MM-DD"})
+		} else if date.After(time.Now()) {
+			errs = append(errs, utils.FieldError{Field: "opened_at", Code: "invalid", Message: "Opening date cannot be in the future"})
+		} else {
+			openedAt = &date
+		}
+	}
+
+	province := ""
+	if req.Latitude == nil || *req.Latitude < -90 || *req.Latitude > 90 {
+		errs = append(errs, utils.FieldError{Field: "latitude", Code: "invalid", Message: "Latitude must be between -90 and 90"})
+	}
+	if req.Longitude == nil || *req.Longitude < -180 || *req.Longitude > 180 {
+		errs = append(errs, utils.FieldError{Field: "longitude", Code: "invalid", Message: "Longitude must be between -180 and 180"})
+	}
+	if len(errs) == 0 {
+		if strings.TrimSpace(req.Province) != "" {
+			provinceData := FindProvinceByName(strings.TrimSpace(req.Province))
+			if provinceData == nil {
+				errs = append(errs, utils.FieldError{Field: "province", Code: "invalid", Message: "Province not found"})
+			} else if !IsCoordinateInProvince(*req.Latitude, *req.Longitude, provinceData) {
+				errs = append(errs, utils.FieldError{Field: "province", Code: "mismatch", Message: "The coordinates are not in this province"})
+			} else {
+				province = provinceData.Properties.Propinsi
+			}
+		} else if provinceData := FindProvinceByCoordinate(*req.Latitude, *req.Longitude); provinceData != nil {
+			province = provinceData.Properties.Propinsi
+		} else {
+			errs = append(errs, utils.FieldError{Field: "latitude", Code: "outside_indonesia", Message: "The coordinates are not in any province of Indonesia"})
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	outlet.Name = name
+	outlet.Address = address
+	outlet.Latitude = *req.Latitude
+	outlet.Longitude = *req.Longitude
+	outlet.Province = province
+	outlet.Type = req.Type
+	outlet.OpenedAt = openedAt
+	return nil
+}
+
+// loadFranchiseOutlets returns the outlets of a franchise in the order they were added
+func loadFranchiseOutlets(db orm.DB, franchiseID uuid.UUID) ([]models.Outlet, error) {
+	outlets := []models.Outlet{}
+	err := db.Model(&outlets).
+		Where("franchise_id = ?", franchiseID).
+		Order("created_at ASC").
+		Select()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load outlets: %v", err)
+	}
+	return outlets, nil
+}
+
+// franchiseOutletsES is the outlets field of the search document
+func franchiseOutletsES(outlets []models.Outlet) []models.OutletES {
+	docs := make([]models.OutletES, len(outlets))
+	for i, outlet := range outlets {
+		docs[i] = models.OutletES{
+			ID:       outlet.ID.String(),
+			Name:     outlet.Name,
+			Province: outlet.Province,
+			Type:     outlet.Type,
+			Location: models.GeoPointES{Lat: outlet.Latitude, Lon: outlet.Longitude},
+		}
+	}
+	return docs
+}
+
+// syncFranchiseOutletsToES rewrites the outlets of a verified franchise in its search document
+func syncFranchiseOutletsToES(app *config.App, franchise *models.Franchise) error {
+	if franchise.Status != models.FranchiseStatusVerified {
+		return nil
+	}
+	outlets, err := loadFranchiseOutlets(app.DB, franchise.ID)
+	if err != nil {
+		return err
+	}
+	_, err = app.ES.Update().
+		Index("franchises").
+		Id(franchise.ID.String()).
+		Doc(map[string]interface{}{"outlets": franchiseOutletsES(outlets)}).
+		Do(context.Background())
+	if err != nil {
+		return fmt.Errorf("failed to update outlets in Elasticsearch: %v", err)
+	}
+	return nil
+}
+
+// loadOwnFranchiseForOutlets loads the :id franchise when it belongs to the user
+func loadOwnFranchiseForOutlets(c *gin.Context, app *config.App) (*models.Franchise, bool) {
+	franchise := &models.Franchise{}
+	err := app.DB.Model(franchise).
+		Where("id = ?", c.Param("id")).
+		Where("user_id = ?", c.GetString("user_id")).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+		return nil, false
+	}
+	return franchise, true
+}
+
+// ListOutlets lists the outlets of a verified franchise. With ?showPrivate=true the owner, or
+// a user who may see private data, gets the outlets of a franchise in any status.
+func ListOutlets(c *gin.Context, app *config.App) {
+	franchise := &models.Franchise{}
+	if c.DefaultQuery("showPrivate", "false") == "true" {
+		var ok bool
+		if franchise, ok = loadFranchiseForHistory(c, app); !ok {
+			return
+		}
+	} else {
+		err := app.DB.Model(franchise).
+			Where("id = ?", c.Param("id")).
+			Where("status = ?", models.FranchiseStatusVerified).
+			Select()
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Franchise not found"})
+			return
+		}
+	}
+
+	outlets, err := loadFranchiseOutlets(app.DB, franchise.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, OutletsResponse{Outlets: outlets})
+}
+
+// CreateOutlet adds an outlet to a franchise of the user
+func CreateOutlet(c *gin.Context, app *config.App) {
+	franchise, ok := loadOwnFranchiseForOutlets(c, app)
+	if !ok {
+		return
+	}
+
+	var req OutletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	outlet := &models.Outlet{
+		ID:          uuid.New(),
+		FranchiseID: franchise.ID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if fieldErrors := applyOutletRequest(&req, outlet); fieldErrors != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outlet", "fields": fieldErrors})
+		return
+	}
+
+	count, err := app.DB.Model((*models.Outlet)(nil)).Where("franchise_id = ?", franchise.ID).Count()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count outlets"})
+		return
+	}
+	if count >= maxFranchiseOutlets {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("A franchise can have at most %d outlets", maxFranchiseOutlets)})
+		return
+	}
+
+	if _, err := app.DB.Model(outlet).Insert(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save outlet: %v", err)})
+		return
+	}
+	if err := syncFranchiseOutletsToES(app, franchise); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusCreated, outlet)
+}
+
+// UpdateOutlet replaces the fields of an outlet
+func UpdateOutlet(c *gin.Context, app *config.App) {
+	franchise, ok := loadOwnFranchiseForOutlets(c, app)
+	if !ok {
+		return
+	}
+
+	outlet := &models.Outlet{}
+	err := app.DB.Model(outlet).
+		Where("id = ?", c.Param("outlet_id")).
+		Where("franchise_id = ?", franchise.ID).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+
+	var req OutletRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if fieldErrors := applyOutletRequest(&req, outlet); fieldErrors != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid outlet", "fields": fieldErrors})
+		return
+	}
+	outlet.UpdatedAt = time.Now()
+
+	_, err = app.DB.Model(outlet).
+		Column("name", "address", "latitude", "longitude", "province", "type", "opened_at", "updated_at").
+		WherePK().
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update outlet: %v", err)})
+		return
+	}
+	if err := syncFranchiseOutletsToES(app, franchise); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, outlet)
+}
+
+// DeleteOutlet removes an outlet from a franchise of the user
+func DeleteOutlet(c *gin.Context, app *config.App) {
+	franchise, ok := loadOwnFranchiseForOutlets(c, app)
+	if !ok {
+		return
+	}
+
+	res, err := app.DB.Model((*models.Outlet)(nil)).
+		Where("id = ?", c.Param("outlet_id")).
+		Where("franchise_id = ?", franchise.ID).
+		Delete()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete outlet"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Outlet not found"})
+		return
+	}
+	if err := syncFranchiseOutletsToES(app, franchise); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Outlet deleted successfully"})
+}
+
+// registeredOutletLocations answers GetFranchiseLocations from the outlet registry. It returns
+// nil when the franchise is not verified or has no registered outlets. A non-nil province keeps
+// only the outlets in that province.
+func registeredOutletLocations(app *config.App, franchiseID string, province *IndonesiaProvince) (*GetFranchiseLocationsResponse, error) {
+	franchise := &models.Franchise{}
+	err := app.DB.Model(franchise).
+		Where("id = ?", franchiseID).
+		Where("status = ?", models.FranchiseStatusVerified).
+		Select()
+	if err != nil {
+		return nil, nil
+	}
+	outlets, err := loadFranchiseOutlets(app.DB, franchise.ID)
+	if err != nil || len(outlets) == 0 {
+		return nil, err
+	}
+
+	response := &GetFranchiseLocationsResponse{Results: []GoogleMapsPlace{}, Status: "OK"}
+	for _, outlet := range outlets {
+		if province != nil && outlet.Province != province.Properties.Propinsi {
+			continue
+		}
+		place := GoogleMapsPlace{
+			PlaceID:          outlet.ID.String(),
+			Name:             outlet.Name,
+			FormattedAddress: outlet.Address,
+		}
+		place.Geometry.Location.Lat = outlet.Latitude
+		place.Geometry.Location.Lng = outlet.Longitude
+		response.Results = append(response.Results, place)
+	}
+	return response, nil
+}
@@ -0,0 +1,200 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const (
+	passwordResetTTL         = 15 * time.Minute
+	passwordResetCooldown    = time.Minute
+	passwordResetMaxAttempts = 3
+)
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+type ResetPasswordRequest struct {
+	Email       string `json:"email" binding:"required,email"`
+	ResetCode   string `json:"reset_code" binding:"required"`
+	NewPassword string `json:"new_password" binding:"required"`
+}
+
+type PendingPasswordReset struct {
+	UserID string `json:"user_id"`
+	Code   string `json:"code"`
+}
+
+// ForgotPassword emails a one-time reset code to the account owner.
+// The response is the same whether or not the email is registered.
+func ForgotPassword(c *gin.Context, app *config.App) {
+	var req ForgotPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	genericResponse := gin.H{
+		"message": "If the email is registered, a password reset code has been sent to it",
+	}
+
+	ctx := context.Background()
+	cooldownKey := fmt.Sprintf("password_reset_cooldown:%s", req.Email)
+	// Only one code per minute to avoid flooding the mailbox
+	ok, err := app.Redis.SetNX(ctx, cooldownKey, "1", passwordResetCooldown).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process password reset"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait a moment before requesting another code"})
+		return
+	}
+
+	var user models.User
+	err = app.DB.Model(&user).Where("email = ?", req.Email).Select()
+	if err != nil {
+		c.JSON(http.StatusOK, genericResponse)
+		return
+	}
+
+	resetCode, err := utils.GenerateVerificationCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate reset code"})
+		return
+	}
+
+	pendingReset := PendingPasswordReset{
+		UserID: user.ID.String(),
+		Code:   resetCode,
+	}
+	pendingJSON, err := json.Marshal(pendingReset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare password reset"})
+		return
+	}
+
+	// Save data with key: password_reset:{email}, a new request replaces the previous code
+	resetKey := fmt.Sprintf("password_reset:%s", req.Email)
+	attemptKey := fmt.Sprintf("password_reset_attempt:%s", req.Email)
+	err = app.Redis.Set(ctx, resetKey, string(pendingJSON), passwordResetTTL).Err()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store password reset"})
+		return
+	}
+	// A new code does not hand out fresh attempts, the count only starts over once it runs out or expires
+	err = app.Redis.SetNX(ctx, attemptKey, "0", passwordResetTTL).Err()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize password reset"})
+		return
+	}
+
+	err = SendPasswordResetEmail(app.Email, user.Email, user.Name, resetCode)
+	if err != nil {
+		fmt.Printf("Warning: Failed to send password reset email to %s: %v\n", user.Email, err)
+	}
+
+	c.JSON(http.StatusOK, genericResponse)
+}
+
+// ResetPassword sets a new password using the emailed reset code and signs out every session
+func ResetPassword(c *gin.Context, app *config.App) {
+	var req ResetPasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !checkAuthThrottle(c, app, passwordResetThrottle, req.Email) {
+		return
+	}
+
+	ctx := context.Background()
+	resetKey := fmt.Sprintf("password_reset:%s", req.Email)
+	attemptKey := fmt.Sprintf("password_reset_attempt:%s", req.Email)
+
+	pendingData, err := app.Redis.Get(ctx, resetKey).Result()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset code is invalid or has expired. Please request a new one"})
+		return
+	}
+
+	var pendingReset PendingPasswordReset
+	if err := json.Unmarshal([]byte(pendingData), &pendingReset); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read password reset data"})
+		return
+	}
+
+	var user models.User
+	err = app.DB.Model(&user).Column("id", "name", "email").Where("id = ?", pendingReset.UserID).Select()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Account no longer exists"})
+		return
+	}
+	// Checked before an attempt is claimed, so a rejected password does not use one up
+	if rejectWeakPassword(c, app, "new_password", req.NewPassword, user.Email, user.Name) {
+		return
+	}
+
+	// Claim the attempt before comparing, so concurrent guesses cannot share one count
+	attempts, err := app.Redis.Incr(ctx, attemptKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attempt data"})
+		return
+	}
+	if attempts == 1 {
+		app.Redis.Expire(ctx, attemptKey, passwordResetTTL)
+	}
+	if attempts > passwordResetMaxAttempts {
+		app.Redis.Del(ctx, resetKey, attemptKey)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reset attempts have reached the maximum limit (3 times). Please request a new code"})
+		return
+	}
+
+	if !strings.EqualFold(pendingReset.Code, strings.TrimSpace(req.ResetCode)) {
+		recordAuthFailure(c, app, passwordResetThrottle, req.Email, user.Name)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":              "Incorrect reset code",
+			"remaining_attempts": passwordResetMaxAttempts - attempts,
+		})
+		return
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to hash password: %v", err)})
+		return
+	}
+
+	res, err := app.DB.Model((*models.User)(nil)).
+		Set("password_hash = ?", hash).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", pendingReset.UserID).
+		Update()
+	if err != nil || res.RowsAffected() == 0 {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	// The code is single-use
+	app.Redis.Del(ctx, resetKey, attemptKey)
+	clearAuthFailures(app, passwordResetThrottle, req.Email)
+
+	// Whoever knew the old password must not stay signed in
+	if _, err := revokeUserSessions(ctx, app, pendingReset.UserID, ""); err != nil {
+		fmt.Printf("Warning: Failed to revoke sessions of user %s: %v\n", pendingReset.UserID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Password has been reset successfully. Please login with your new password"})
+}
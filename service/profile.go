@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const (
+	emailChangeTTL         = 15 * time.Minute
+	emailChangeCooldown    = time.Minute
+	emailChangeMaxAttempts = 3
+)
+
+type UpdateProfileRequest struct {
+	Name string `json:"name" binding:"required"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+type ChangeEmailRequest struct {
+	NewEmail string `json:"new_email" binding:"required,email"`
+	Password string `json:"password" binding:"required"`
+}
+
+type ConfirmEmailChangeRequest struct {
+	VerificationCode string `json:"verification_code" binding:"required"`
+}
+
+type PendingEmailChange struct {
+	NewEmail string `json:"new_email"`
+	Code     string `json:"code"`
+}
+
+// UpdateProfile changes the display name, franchisors also get it updated on their listings
+func UpdateProfile(c *gin.Context, app *config.App) {
+	var req UpdateProfileRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Name cannot be empty"})
+		return
+	}
+
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", c.GetString("user_id")).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.Name = name
+	user.UpdatedAt = time.Now()
+	_, err = app.DB.Model(&user).Column("name", "updated_at").Where("id = ?", user.ID).Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
+		return
+	}
+
+	if user.Role == models.RoleFranchisor {
+		if err := syncFranchisorNameToES(app, &user); err != nil {
+			fmt.Printf("Warning: Failed to update franchisor name in Elasticsearch: %v\n", err)
+		}
+	}
+
+	c.JSON(http.StatusOK, GetProfileResponse{
+		ID:    user.ID.String(),
+		Name:  user.Name,
+		Email: user.Email,
+		Role:  user.Role,
+	})
+}
+
+// syncFranchisorNameToES updates the owner name embedded in the franchisor's indexed listings
+func syncFranchisorNameToES(app *config.App, user *models.User) error {
+	var franchises []models.Franchise
+	err := app.DB.Model(&franchises).
+		Column("id").
+		Where("user_id = ?", user.ID).
+		Where("status = ?", models.FranchiseStatusVerified).
+		Select()
+	if err != nil {
+		return err
+	}
+
+	updateDoc := map[string]interface{}{
+		"user": models.UserES{
+			UserID: user.ID.String(),
+			Name:   user.Name,
+		},
+	}
+	for _, franchise := range franchises {
+		_, err = app.ES.Update().
+			Index("franchises").
+			Id(franchise.ID.String()).
+			Doc(updateDoc).
+			Do(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to update Franchise %s in Elasticsearch: %v", franchise.ID, err)
+		}
+	}
+	return nil
+}
+
+// ChangePassword sets a new password and signs out every other session
+func ChangePassword(c *gin.Context, app *config.App) {
+	var req ChangePasswordRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if ok, _, _ := utils.VerifyPassword(user.PasswordHash, req.CurrentPassword); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Current password is incorrect"})
+		return
+	}
+
+	if rejectWeakPassword(c, app, "new_password", req.NewPassword, user.Email, user.Name) {
+		return
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to hash password: %v", err)})
+		return
+	}
+
+	_, err = app.DB.Model((*models.User)(nil)).
+		Set("password_hash = ?", hash).
+		Set("updated_at = ?", time.Now()).
+		Where("id = ?", userID).
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
+		return
+	}
+
+	revoked, err := revokeUserSessions(context.Background(), app, userID, c.GetString("session_id"))
+	if err != nil {
+		fmt.Printf("Warning: Failed to revoke sessions of user %s: %v\n", userID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Password has been changed successfully",
+		"revoked_sessions": revoked,
+	})
+}
+
+// ChangeEmail sends a code to the new address, the email is only switched once it is confirmed
+func ChangeEmail(c *gin.Context, app *config.App) {
+	var req ChangeEmailRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if ok, _, _ := utils.VerifyPassword(user.PasswordHash, req.Password); !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	if strings.EqualFold(req.NewEmail, user.Email) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "New email is the same as the current email"})
+		return
+	}
+	if !isEmailAvailable(app, req.NewEmail) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already registered"})
+		return
+	}
+
+	ctx := context.Background()
+	cooldownKey := fmt.Sprintf("email_change_cooldown:%s", userID)
+	ok, err := app.Redis.SetNX(ctx, cooldownKey, "1", emailChangeCooldown).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process email change"})
+		return
+	}
+	if !ok {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": "Please wait a moment before requesting another code"})
+		return
+	}
+
+	verificationCode, err := utils.GenerateVerificationCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification code"})
+		return
+	}
+
+	pendingJSON, err := json.Marshal(PendingEmailChange{NewEmail: req.NewEmail, Code: verificationCode})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to prepare email change"})
+		return
+	}
+
+	// Save data with key: email_change:{userID}, a new request replaces the previous one
+	changeKey := fmt.Sprintf("email_change:%s", userID)
+	attemptKey := fmt.Sprintf("email_change_attempt:%s", userID)
+	err = app.Redis.Set(ctx, changeKey, string(pendingJSON), emailChangeTTL).Err()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to store email change"})
+		return
+	}
+	err = app.Redis.Set(ctx, attemptKey, "0", emailChangeTTL).Err()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to initialize email change"})
+		return
+	}
+
+	err = SendEmailChangeCode(app.Email, req.NewEmail, user.Name, verificationCode)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "A verification code has been sent to the new email address"})
+}
+
+// ConfirmEmailChange switches the email after the code sent to the new address is confirmed
+func ConfirmEmailChange(c *gin.Context, app *config.App) {
+	var req ConfirmEmailChangeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	userID := c.GetString("user_id")
+	ctx := context.Background()
+	changeKey := fmt.Sprintf("email_change:%s", userID)
+	attemptKey := fmt.Sprintf("email_change_attempt:%s", userID)
+
+	pendingData, err := app.Redis.Get(ctx, changeKey).Result()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification code is invalid or has expired. Please request a new one"})
+		return
+	}
+
+	var pendingChange PendingEmailChange
+	if err := json.Unmarshal([]byte(pendingData), &pendingChange); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read email change data"})
+		return
+	}
+
+	// Claim the attempt before comparing, so concurrent guesses cannot share one count
+	attempts, err := app.Redis.Incr(ctx, attemptKey).Result()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read attempt data"})
+		return
+	}
+	if attempts == 1 {
+		app.Redis.Expire(ctx, attemptKey, emailChangeTTL)
+	}
+	if attempts > emailChangeMaxAttempts {
+		app.Redis.Del(ctx, changeKey, attemptKey)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Verification attempts have reached the maximum limit (3 times). Please request a new code"})
+		return
+	}
+
+	if !strings.EqualFold(pendingChange.Code, req.VerificationCode) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":              "Incorrect verification code",
+			"remaining_attempts": emailChangeMaxAttempts - attempts,
+		})
+		return
+	}
+
+	var user models.User
+	err = app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+	oldEmail := user.Email
+
+	// The address may have been taken while the code was pending
+	if !isEmailAvailable(app, pendingChange.NewEmail) {
+		app.Redis.Del(ctx, changeKey, attemptKey)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already registered"})
+		return
+	}
+
+	user.Email = pendingChange.NewEmail
+	user.UpdatedAt = time.Now()
+	_, err = app.DB.Model(&user).Column("email", "updated_at").Where("id = ?", user.ID).Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email"})
+		return
+	}
+
+	// The code is single-use
+	app.Redis.Del(ctx, changeKey, attemptKey)
+
+	err = SendEmailChangedNotice(app.Email, oldEmail, user.Name, user.Email)
+	if err != nil {
+		fmt.Printf("Warning: Failed to notify %s about the email change: %v\n", oldEmail, err)
+	}
+
+	c.JSON(http.StatusOK, GetProfileResponse{
+		ID:    user.ID.String(),
+		Name:  user.Name,
+		Email: user.Email,
+		Role:  user.Role,
+	})
+}
+
+// isEmailAvailable reports whether nobody uses or is registering with the email
+func isEmailAvailable(app *config.App, email string) bool {
+	exists, err := app.DB.Model((*models.User)(nil)).Where("LOWER(email) = LOWER(?)", email).Exists()
+	if err != nil || exists {
+		return false
+	}
+	pending, err := app.Redis.Exists(context.Background(), pendingRegistrationKey(email)).Result()
+	return err == nil && pending == 0
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-pg/pg/v10"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// PurgeFranchise permanently deletes a franchise together with its boosts and payments,
+// its search document and its uploaded files.
+func PurgeFranchise(ctx context.Context, app *config.App, franchise *models.Franchise) error {
+	err := app.DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		return purgeFranchiseRows(tx, franchise.ID.String())
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete franchise %s: %v", franchise.ID, err)
+	}
+
+	if err := deleteFranchiseFromES(app, franchise.ID.String()); err != nil {
+		return fmt.Errorf("failed to delete franchise %s from Elasticsearch: %v", franchise.ID, err)
+	}
+
+	deleteFranchiseFiles(franchise)
+	return nil
+}
+
+func purgeFranchiseRows(tx *pg.Tx, franchiseID string) error {
+	_, err := tx.Model((*models.Payment)(nil)).
+		Where("boost_id IN (SELECT id FROM franchiso.boosts WHERE franchise_id = ?)", franchiseID).
+		Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*models.Boost)(nil)).Where("franchise_id = ?", franchiseID).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*models.FranchiseRevision)(nil)).Where("franchise_id = ?", franchiseID).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*models.FranchiseChangeRequest)(nil)).Where("franchise_id = ?", franchiseID).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*models.FranchisePackage)(nil)).Where("franchise_id = ?", franchiseID).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*models.Outlet)(nil)).Where("franchise_id = ?", franchiseID).Delete()
+	if err != nil {
+		return err
+	}
+	_, err = tx.Model((*models.Franchise)(nil)).Where("id = ?", franchiseID).AllWithDeleted().ForceDelete()
+	return err
+}
+
+// deleteFranchiseFiles removes the uploaded files, failures are only logged
+// because the database rows are already gone
+func deleteFranchiseFiles(franchise *models.Franchise) {
+	for _, file := range franchiseFiles(franchise) {
+		if file == "" {
+			continue
+		}
+		if err := utils.DeleteFromStorageProxy(file); err != nil {
+			fmt.Printf("Warning: Failed to delete file %s of franchise %s: %v\n", file, franchise.ID, err)
+		}
+	}
+}
+
+// franchiseFiles lists the uploaded files of a franchise, empty fields included
+func franchiseFiles(franchise *models.Franchise) []string {
+	return append([]string{franchise.Logo, franchise.Stpw, franchise.NIB, franchise.NPWP}, franchise.AdPhotos...)
+}
+
+// ReferencedUploadFiles returns the storage file names still in use: the files of every
+// franchise, archived ones included, of the revision snapshots, which a restore brings back,
+// and of the pending change requests
+func ReferencedUploadFiles(ctx context.Context, app *config.App) (map[string]bool, error) {
+	referenced := map[string]bool{}
+	add := func(franchise *models.Franchise) {
+		for _, file := range franchiseFiles(franchise) {
+			if file != "" {
+				referenced[utils.StorageFileName(file)] = true
+			}
+		}
+	}
+
+	var franchises []models.Franchise
+	err := app.DB.ModelContext(ctx, &franchises).
+		Column("logo", "ad_photos", "stpw", "nib", "npwp").
+		AllWithDeleted().
+		Select()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get franchise files: %v", err)
+	}
+	for i := range franchises {
+		add(&franchises[i])
+	}
+
+	err = app.DB.ModelContext(ctx, (*models.FranchiseRevision)(nil)).
+		Column("snapshot").
+		ForEach(func(revision *models.FranchiseRevision) error {
+			if revision.Snapshot != nil {
+				add(revision.Snapshot)
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revision files: %v", err)
+	}
+
+	var requests []models.FranchiseChangeRequest
+	err = app.DB.ModelContext(ctx, &requests).
+		Column("proposed").
+		Where("status = ?", models.ChangeRequestPending).
+		Select()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get change request files: %v", err)
+	}
+	for _, request := range requests {
+		if request.Proposed != nil {
+			add(request.Proposed)
+		}
+	}
+
+	return referenced, nil
+}
+
+// PurgeUser permanently deletes a user and everything they own
+func PurgeUser(ctx context.Context, app *config.App, userID string) error {
+	var user models.User
+	err := app.DB.Model(&user).Where("id = ?", userID).Select()
+	if err != nil {
+		return fmt.Errorf("failed to get user %s: %v", userID, err)
+	}
+
+	var franchises []models.Franchise
+	err = app.DB.Model(&franchises).Where("user_id = ?", userID).AllWithDeleted().Select()
+	if err != nil {
+		return fmt.Errorf("failed to get franchises of user %s: %v", userID, err)
+	}
+
+	err = app.DB.RunInTransaction(ctx, func(tx *pg.Tx) error {
+		for _, franchise := range franchises {
+			if err := purgeFranchiseRows(tx, franchise.ID.String()); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Model((*models.Session)(nil)).Where("user_id = ?", userID).Delete(); err != nil {
+			return err
+		}
+		if _, err := tx.Model((*models.APIKey)(nil)).Where("user_id = ?", userID).Delete(); err != nil {
+			return err
+		}
+		if _, err := tx.Model((*models.UserMFA)(nil)).Where("user_id = ?", userID).Delete(); err != nil {
+			return err
+		}
+		if _, err := tx.Model((*models.AdminInvitation)(nil)).Where("email = ?", user.Email).Delete(); err != nil {
+			return err
+		}
+		_, err := tx.Model((*models.User)(nil)).Where("id = ?", userID).Delete()
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete user %s: %v", userID, err)
+	}
+
+	app.Redis.Del(ctx, knownDevicesKey(userID), knownCountriesKey(userID))
+
+	for i := range franchises {
+		if err := deleteFranchiseFromES(app, franchises[i].ID.String()); err != nil {
+			fmt.Printf("Warning: Failed to delete franchise %s from Elasticsearch: %v\n", franchises[i].ID, err)
+		}
+		deleteFranchiseFiles(&franchises[i])
+	}
+	return nil
+}
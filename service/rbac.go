@@ -0,0 +1,283 @@
+package service
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/middleware"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+const adminInvitationTTL = 72 * time.Hour
+
+type CreateAdminInvitationRequest struct {
+	Email string `json:"email" binding:"required,email"`
+	Role  string `json:"role" binding:"required,oneof=SuperAdmin Moderator Finance"`
+}
+
+type CreateAdminInvitationResponse struct {
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AcceptAdminInvitationRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Name     string `json:"name" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type RoleResponse struct {
+	Name        string   `json:"name"`
+	IsPublic    bool     `json:"is_public"`
+	Permissions []string `json:"permissions"`
+}
+
+type ListRolesResponse struct {
+	Roles []RoleResponse `json:"roles"`
+}
+
+type UpdateRolePermissionsRequest struct {
+	Permissions []string `json:"permissions" binding:"required"`
+}
+
+// CreateAdminInvitation invites a staff member by email, staff roles cannot be self-registered
+func CreateAdminInvitation(c *gin.Context, app *config.App) {
+	var req CreateAdminInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var existingUser models.User
+	err := app.DB.Model(&existingUser).Where("email = ?", req.Email).Select()
+	if err == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already registered"})
+		return
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invitation token"})
+		return
+	}
+
+	invitation := models.AdminInvitation{
+		ID:        uuid.New(),
+		Email:     req.Email,
+		Role:      req.Role,
+		TokenHash: utils.HashToken(token),
+		InvitedBy: uuid.MustParse(c.GetString("user_id")),
+		ExpiresAt: time.Now().Add(adminInvitationTTL),
+		CreatedAt: time.Now(),
+	}
+	_, err = app.DB.Model(&invitation).Insert()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to save invitation: %v", err)})
+		return
+	}
+
+	invitationLink := fmt.Sprintf("%s/accept-invitation?token=%s", app.Email.AppBaseURL, url.QueryEscape(token))
+	err = SendAdminInvitationEmail(app.Email, req.Email, req.Role, invitationLink)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Invitation saved but failed to send invitation email"})
+		return
+	}
+
+	c.JSON(http.StatusOK, CreateAdminInvitationResponse{
+		ID:        invitation.ID.String(),
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		ExpiresAt: invitation.ExpiresAt,
+	})
+}
+
+// AcceptAdminInvitation creates the staff account of a pending invitation
+func AcceptAdminInvitation(c *gin.Context, app *config.App) {
+	var req AcceptAdminInvitationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var invitation models.AdminInvitation
+	err := app.DB.Model(&invitation).
+		Where("token_hash = ?", utils.HashToken(req.Token)).
+		Where("accepted_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invitation is invalid or has expired"})
+		return
+	}
+
+	if rejectWeakPassword(c, app, "password", req.Password, invitation.Email, req.Name) {
+		return
+	}
+
+	hash, err := utils.HashPassword(req.Password)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to hash password: %v", err)})
+		return
+	}
+
+	user := models.User{
+		ID:           uuid.New(),
+		Name:         req.Name,
+		Email:        invitation.Email,
+		PasswordHash: hash,
+		Role:         invitation.Role,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+
+	err = app.DB.RunInTransaction(c.Request.Context(), func(tx *pg.Tx) error {
+		// Claim the invitation first so it cannot be accepted twice
+		res, err := tx.Model((*models.AdminInvitation)(nil)).
+			Set("accepted_at = ?", time.Now()).
+			Where("id = ?", invitation.ID).
+			Where("accepted_at IS NULL").
+			Update()
+		if err != nil {
+			return err
+		}
+		if res.RowsAffected() == 0 {
+			return fmt.Errorf("invitation has already been accepted")
+		}
+		_, err = tx.Model(&user).Insert()
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Failed to accept invitation: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Account created successfully. Please login",
+		"user": UserResponse{
+			ID:    user.ID.String(),
+			Name:  user.Name,
+			Email: user.Email,
+			Role:  user.Role,
+		},
+	})
+}
+
+// ListRoles displays every role with its granted permissions
+func ListRoles(c *gin.Context, app *config.App) {
+	var roles []models.Role
+	err := app.DB.Model(&roles).Order("name ASC").Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch roles"})
+		return
+	}
+
+	var rolePermissions []models.RolePermission
+	err = app.DB.Model(&rolePermissions).Order("permission ASC").Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch role permissions"})
+		return
+	}
+
+	permissionsByRole := map[string][]string{}
+	for _, rp := range rolePermissions {
+		permissionsByRole[rp.Role] = append(permissionsByRole[rp.Role], rp.Permission)
+	}
+
+	resp := ListRolesResponse{Roles: []RoleResponse{}}
+	for _, role := range roles {
+		permissions := permissionsByRole[role.Name]
+		if permissions == nil {
+			permissions = []string{}
+		}
+		resp.Roles = append(resp.Roles, RoleResponse{
+			Name:        role.Name,
+			IsPublic:    role.IsPublic,
+			Permissions: permissions,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// UpdateRolePermissions replaces the permission set of a role
+func UpdateRolePermissions(c *gin.Context, app *config.App) {
+	roleName := c.Param("role")
+	var req UpdateRolePermissionsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var role models.Role
+	err := app.DB.Model(&role).Where("name = ?", roleName).Select()
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return
+	}
+
+	// A permission listed twice would otherwise fail the count below and the insert
+	permissions := []string{}
+	for _, permission := range req.Permissions {
+		if !containsString(permissions, permission) {
+			permissions = append(permissions, permission)
+		}
+	}
+	req.Permissions = permissions
+
+	if len(req.Permissions) > 0 {
+		count, err := app.DB.Model((*models.Permission)(nil)).
+			Where("name IN (?)", pg.In(req.Permissions)).
+			Count()
+		if err != nil || count != len(req.Permissions) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown permission"})
+			return
+		}
+	}
+
+	// Prevent a SuperAdmin from locking everyone out of role management
+	if roleName == c.GetString("role") && !containsString(req.Permissions, models.PermRoleManage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot remove role management from your own role"})
+		return
+	}
+
+	err = app.DB.RunInTransaction(c.Request.Context(), func(tx *pg.Tx) error {
+		_, err := tx.Model((*models.RolePermission)(nil)).Where("role = ?", roleName).Delete()
+		if err != nil {
+			return err
+		}
+		for _, permission := range req.Permissions {
+			rp := models.RolePermission{Role: roleName, Permission: permission, CreatedAt: time.Now()}
+			if _, err := tx.Model(&rp).Insert(); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to update role permissions: %v", err)})
+		return
+	}
+
+	middleware.InvalidateRolePermissions(app, roleName)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role permissions updated successfully"})
+}
+
+func containsString(values []string, target string) bool {
+	for _, value := range values {
+		if value == target {
+			return true
+		}
+	}
+	return false
+}
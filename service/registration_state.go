@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The pending registration state lives in two Redis keys: the registration data
+// (PendingUserData as JSON) and the number of wrong codes. Every transition is a
+// Lua script so concurrent requests cannot interleave between reading and writing.
+
+const (
+	pendingRegistrationTTL  = 10 * time.Minute
+	verificationMaxAttempts = 3
+)
+
+// Results of consumeVerificationCode
+const (
+	verificationMissing   = "missing"
+	verificationExhausted = "exhausted"
+	verificationMismatch  = "mismatch"
+	verificationOK        = "ok"
+)
+
+func pendingRegistrationKey(email string) string {
+	return fmt.Sprintf("pending_registration:%s", email)
+}
+
+func verificationAttemptKey(email string) string {
+	return fmt.Sprintf("verification_attempt:%s", email)
+}
+
+// KEYS: pending, attempts. ARGV: data, ttl in ms.
+// Stores the registration only when none is pending for the email.
+var createPendingRegistrationScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SET", KEYS[2], "0", "PX", ARGV[2])
+return 1
+`)
+
+// KEYS: pending, attempts. ARGV: data, ttl in ms.
+// Replaces the registration (new code) only while it is still pending.
+var replacePendingRegistrationScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+redis.call("SET", KEYS[2], "0", "PX", ARGV[2])
+return 1
+`)
+
+// KEYS: pending, attempts. ARGV: code, max attempts.
+// Checks the code and counts a wrong one in a single step. A correct code consumes
+// the registration, so only one of several concurrent requests can succeed.
+var consumeVerificationCodeScript = redis.NewScript(`
+local data = redis.call("GET", KEYS[1])
+if not data then
+	return {"missing"}
+end
+local max = tonumber(ARGV[2])
+local attempts = tonumber(redis.call("GET", KEYS[2]) or "0")
+if attempts >= max then
+	redis.call("DEL", KEYS[1], KEYS[2])
+	return {"exhausted"}
+end
+if cjson.decode(data)["code"] ~= ARGV[1] then
+	attempts = redis.call("INCR", KEYS[2])
+	redis.call("PEXPIRE", KEYS[2], redis.call("PTTL", KEYS[1]))
+	return {"mismatch", data, tostring(max - attempts)}
+end
+local ttl = redis.call("PTTL", KEYS[1])
+redis.call("DEL", KEYS[1], KEYS[2])
+return {"ok", data, tostring(ttl)}
+`)
+
+// KEYS: pending, attempts. ARGV: data the caller has checked.
+// Deletes the registration unless it changed in the meantime, e.g. a new code was sent.
+var deletePendingRegistrationScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) ~= ARGV[1] then
+	return 0
+end
+redis.call("DEL", KEYS[1], KEYS[2])
+return 1
+`)
+
+// createPendingRegistration stores a new registration, false when one is already pending
+func createPendingRegistration(ctx context.Context, client *redis.Client, email, data string, ttl time.Duration) (bool, error) {
+	keys := []string{pendingRegistrationKey(email), verificationAttemptKey(email)}
+	created, err := createPendingRegistrationScript.Run(ctx, client, keys, data, ttl.Milliseconds()).Int()
+	return created == 1, err
+}
+
+// replacePendingRegistration swaps in new registration data, false when nothing is pending anymore
+func replacePendingRegistration(ctx context.Context, client *redis.Client, email, data string) (bool, error) {
+	keys := []string{pendingRegistrationKey(email), verificationAttemptKey(email)}
+	replaced, err := replacePendingRegistrationScript.Run(ctx, client, keys, data, pendingRegistrationTTL.Milliseconds()).Int()
+	return replaced == 1, err
+}
+
+// deletePendingRegistration removes the registration if it still holds data
+func deletePendingRegistration(ctx context.Context, client *redis.Client, email, data string) (bool, error) {
+	keys := []string{pendingRegistrationKey(email), verificationAttemptKey(email)}
+	deleted, err := deletePendingRegistrationScript.Run(ctx, client, keys, data).Int()
+	return deleted == 1, err
+}
+
+// verificationResult is the outcome of consumeVerificationCode. Data is set for
+// verificationMismatch and verificationOK, RemainingAttempts for verificationMismatch
+// and TTL, the time the registration had left, for verificationOK.
+type verificationResult struct {
+	Status            string
+	Data              string
+	RemainingAttempts int
+	TTL               time.Duration
+}
+
+func consumeVerificationCode(ctx context.Context, client *redis.Client, email, code string) (verificationResult, error) {
+	keys := []string{pendingRegistrationKey(email), verificationAttemptKey(email)}
+	values, err := consumeVerificationCodeScript.Run(ctx, client, keys, code, verificationMaxAttempts).StringSlice()
+	if err != nil {
+		return verificationResult{}, err
+	}
+
+	result := verificationResult{Status: values[0]}
+	switch result.Status {
+	case verificationMismatch:
+		result.Data = values[1]
+		result.RemainingAttempts, _ = strconv.Atoi(values[2])
+	case verificationOK:
+		result.Data = values[1]
+		ttl, _ := strconv.ParseInt(values[2], 10, 64)
+		result.TTL = time.Duration(ttl) * time.Millisecond
+	}
+	return result, nil
+}
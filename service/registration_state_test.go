@@ -0,0 +1,327 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+const testRegistrationEmail = "franchisor@example.com"
+
+func newTestRedis(t *testing.T) (*miniredis.Miniredis, *redis.Client) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), PoolSize: 50})
+	t.Cleanup(func() { client.Close() })
+	return server, client
+}
+
+func testRegistrationData(t *testing.T, name, code string) string {
+	t.Helper()
+	data, err := json.Marshal(PendingUserData{Name: name, Email: testRegistrationEmail, Code: code})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// runConcurrently starts every fn at once and waits for all of them
+func runConcurrently(fns ...func()) {
+	var start, done sync.WaitGroup
+	start.Add(1)
+	for _, fn := range fns {
+		done.Add(1)
+		go func(fn func()) {
+			defer done.Done()
+			start.Wait()
+			fn()
+		}(fn)
+	}
+	start.Done()
+	done.Wait()
+}
+
+func TestCreatePendingRegistrationOnlyOneWins(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+
+	const requests = 20
+	created := make([]bool, requests)
+	data := make([]string, requests)
+	fns := []func(){}
+	for i := 0; i < requests; i++ {
+		i := i
+		data[i] = testRegistrationData(t, fmt.Sprintf("user %d", i), fmt.Sprintf("%06d", i))
+		fns = append(fns, func() {
+			ok, err := createPendingRegistration(ctx, client, testRegistrationEmail, data[i], pendingRegistrationTTL)
+			if err != nil {
+				t.Errorf("create %d: %v", i, err)
+			}
+			created[i] = ok
+		})
+	}
+	runConcurrently(fns...)
+
+	winners := 0
+	for i, ok := range created {
+		if !ok {
+			continue
+		}
+		winners++
+		stored, err := server.Get(pendingRegistrationKey(testRegistrationEmail))
+		if err != nil || stored != data[i] {
+			t.Errorf("stored registration = %q, want the winner's %q", stored, data[i])
+		}
+	}
+	if winners != 1 {
+		t.Fatalf("%d registrations were created, want exactly 1", winners)
+	}
+	if attempts, _ := server.Get(verificationAttemptKey(testRegistrationEmail)); attempts != "0" {
+		t.Errorf("attempts = %q, want 0", attempts)
+	}
+}
+
+func TestConsumeVerificationCodeConcurrentCorrectAndWrongCodes(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+
+	data := testRegistrationData(t, "user", "123456")
+	if ok, err := createPendingRegistration(ctx, client, testRegistrationEmail, data, pendingRegistrationTTL); !ok || err != nil {
+		t.Fatalf("create = %v, %v", ok, err)
+	}
+
+	// Fewer wrong codes than allowed, so one of the correct codes must get through
+	const correct, wrong = 10, verificationMaxAttempts - 1
+	var mu sync.Mutex
+	results := map[string][]verificationResult{}
+	consume := func(code string) func() {
+		return func() {
+			result, err := consumeVerificationCode(ctx, client, testRegistrationEmail, code)
+			if err != nil {
+				t.Errorf("consume %s: %v", code, err)
+				return
+			}
+			mu.Lock()
+			results[code] = append(results[code], result)
+			mu.Unlock()
+		}
+	}
+	fns := []func(){}
+	for i := 0; i < correct; i++ {
+		fns = append(fns, consume("123456"))
+	}
+	for i := 0; i < wrong; i++ {
+		fns = append(fns, consume("000000"))
+	}
+	runConcurrently(fns...)
+
+	consumed := 0
+	for _, result := range results["123456"] {
+		switch result.Status {
+		case verificationOK:
+			consumed++
+			if result.Data != data {
+				t.Errorf("consumed data = %q, want %q", result.Data, data)
+			}
+		case verificationMissing:
+		default:
+			t.Errorf("correct code got %q", result.Status)
+		}
+	}
+	if consumed != 1 {
+		t.Fatalf("the registration was consumed %d times, want exactly 1", consumed)
+	}
+
+	// Every wrong code before the consumption is counted once, so no two see the same count
+	remaining := map[int]bool{}
+	for _, result := range results["000000"] {
+		switch result.Status {
+		case verificationMismatch:
+			if remaining[result.RemainingAttempts] {
+				t.Errorf("two wrong codes were left %d attempts", result.RemainingAttempts)
+			}
+			remaining[result.RemainingAttempts] = true
+			if result.RemainingAttempts < 1 || result.RemainingAttempts >= verificationMaxAttempts {
+				t.Errorf("remaining attempts = %d", result.RemainingAttempts)
+			}
+		case verificationMissing:
+		default:
+			t.Errorf("wrong code got %q", result.Status)
+		}
+	}
+
+	if server.Exists(pendingRegistrationKey(testRegistrationEmail)) || server.Exists(verificationAttemptKey(testRegistrationEmail)) {
+		t.Error("the consumed registration is still stored")
+	}
+}
+
+func TestConsumeVerificationCodeConcurrentWrongCodesExhaust(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+
+	data := testRegistrationData(t, "user", "123456")
+	if ok, err := createPendingRegistration(ctx, client, testRegistrationEmail, data, pendingRegistrationTTL); !ok || err != nil {
+		t.Fatalf("create = %v, %v", ok, err)
+	}
+
+	const requests = 12
+	var mu sync.Mutex
+	statuses := map[string]int{}
+	fns := []func(){}
+	for i := 0; i < requests; i++ {
+		fns = append(fns, func() {
+			result, err := consumeVerificationCode(ctx, client, testRegistrationEmail, "999999")
+			if err != nil {
+				t.Errorf("consume: %v", err)
+				return
+			}
+			mu.Lock()
+			statuses[result.Status]++
+			mu.Unlock()
+		})
+	}
+	runConcurrently(fns...)
+
+	want := map[string]int{
+		verificationMismatch:  verificationMaxAttempts,
+		verificationExhausted: 1,
+		verificationMissing:   requests - verificationMaxAttempts - 1,
+	}
+	for status, count := range want {
+		if statuses[status] != count {
+			t.Errorf("%d requests got %q, want %d (all: %v)", statuses[status], status, count, statuses)
+		}
+	}
+	if server.Exists(pendingRegistrationKey(testRegistrationEmail)) || server.Exists(verificationAttemptKey(testRegistrationEmail)) {
+		t.Error("the exhausted registration is still stored")
+	}
+
+	// The correct code no longer works once the attempts are used up
+	result, err := consumeVerificationCode(ctx, client, testRegistrationEmail, "123456")
+	if err != nil || result.Status != verificationMissing {
+		t.Errorf("consume after exhaustion = %q, %v, want %q", result.Status, err, verificationMissing)
+	}
+}
+
+func TestReplacePendingRegistrationRacesConsume(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		server.FlushAll()
+		oldData := testRegistrationData(t, "user", "111111")
+		newData := testRegistrationData(t, "user", "222222")
+		if ok, err := createPendingRegistration(ctx, client, testRegistrationEmail, oldData, pendingRegistrationTTL); !ok || err != nil {
+			t.Fatalf("create = %v, %v", ok, err)
+		}
+
+		var replaced bool
+		var result verificationResult
+		runConcurrently(
+			func() {
+				var err error
+				if replaced, err = replacePendingRegistration(ctx, client, testRegistrationEmail, newData); err != nil {
+					t.Errorf("replace: %v", err)
+				}
+			},
+			func() {
+				var err error
+				if result, err = consumeVerificationCode(ctx, client, testRegistrationEmail, "111111"); err != nil {
+					t.Errorf("consume: %v", err)
+				}
+			},
+		)
+
+		stored, _ := server.Get(pendingRegistrationKey(testRegistrationEmail))
+		attempts, _ := server.Get(verificationAttemptKey(testRegistrationEmail))
+		switch {
+		case result.Status == verificationOK && !replaced:
+			// Consumed first, there was nothing left to replace
+			if server.Exists(pendingRegistrationKey(testRegistrationEmail)) {
+				t.Fatalf("iteration %d: registration stored after it was consumed: %q", i, stored)
+			}
+		case result.Status == verificationMismatch && replaced:
+			// Replaced first, the old code is wrong and counted against the new registration
+			if stored != newData || attempts != "1" {
+				t.Fatalf("iteration %d: stored %q with %q attempts, want the new registration with 1", i, stored, attempts)
+			}
+		default:
+			t.Fatalf("iteration %d: consume %q and replaced %v", i, result.Status, replaced)
+		}
+	}
+}
+
+func TestDeletePendingRegistrationAfterReplace(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+
+	oldData := testRegistrationData(t, "user", "111111")
+	newData := testRegistrationData(t, "user", "222222")
+	if ok, err := createPendingRegistration(ctx, client, testRegistrationEmail, oldData, pendingRegistrationTTL); !ok || err != nil {
+		t.Fatalf("create = %v, %v", ok, err)
+	}
+	if ok, err := replacePendingRegistration(ctx, client, testRegistrationEmail, newData); !ok || err != nil {
+		t.Fatalf("replace = %v, %v", ok, err)
+	}
+
+	// A cancel that checked the old data must not delete the new code
+	if deleted, err := deletePendingRegistration(ctx, client, testRegistrationEmail, oldData); deleted || err != nil {
+		t.Fatalf("delete with the replaced data = %v, %v, want false", deleted, err)
+	}
+	if stored, _ := server.Get(pendingRegistrationKey(testRegistrationEmail)); stored != newData {
+		t.Fatalf("stored registration = %q, want %q", stored, newData)
+	}
+
+	if deleted, err := deletePendingRegistration(ctx, client, testRegistrationEmail, newData); !deleted || err != nil {
+		t.Fatalf("delete with the current data = %v, %v, want true", deleted, err)
+	}
+	if server.Exists(pendingRegistrationKey(testRegistrationEmail)) || server.Exists(verificationAttemptKey(testRegistrationEmail)) {
+		t.Error("the deleted registration is still stored")
+	}
+}
+
+func TestDeletePendingRegistrationRacesReplace(t *testing.T) {
+	server, client := newTestRedis(t)
+	ctx := context.Background()
+
+	for i := 0; i < 50; i++ {
+		server.FlushAll()
+		oldData := testRegistrationData(t, "user", "111111")
+		newData := testRegistrationData(t, "user", "222222")
+		if ok, err := createPendingRegistration(ctx, client, testRegistrationEmail, oldData, pendingRegistrationTTL); !ok || err != nil {
+			t.Fatalf("create = %v, %v", ok, err)
+		}
+
+		var deleted, replaced bool
+		runConcurrently(
+			func() {
+				var err error
+				if deleted, err = deletePendingRegistration(ctx, client, testRegistrationEmail, oldData); err != nil {
+					t.Errorf("delete: %v", err)
+				}
+			},
+			func() {
+				var err error
+				if replaced, err = replacePendingRegistration(ctx, client, testRegistrationEmail, newData); err != nil {
+					t.Errorf("replace: %v", err)
+				}
+			},
+		)
+
+		if deleted == replaced {
+			t.Fatalf("iteration %d: deleted %v and replaced %v, want exactly one", i, deleted, replaced)
+		}
+		stored, _ := server.Get(pendingRegistrationKey(testRegistrationEmail))
+		if replaced && stored != newData {
+			t.Fatalf("iteration %d: stored %q after the replace won, want %q", i, stored, newData)
+		}
+		if deleted && server.Exists(pendingRegistrationKey(testRegistrationEmail)) {
+			t.Fatalf("iteration %d: registration stored after the delete won: %q", i, stored)
+		}
+	}
+}
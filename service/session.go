@@ -0,0 +1,405 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-pg/pg/v10"
+	"github.com/google/uuid"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/middleware"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Current    bool      `json:"current"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	Country    string    `json:"country"`
+	City       string    `json:"city"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+type ListSessionsResponse struct {
+	Sessions []SessionResponse `json:"sessions"`
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RefreshTokenResponse struct {
+	AccessToken  string `json:"access_token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+}
+
+// issueSession creates a session row for the user, recording the device of the request,
+// and returns its access and refresh token pair
+func issueSession(c *gin.Context, app *config.App, user *models.User) (string, string, error) {
+	sessionID := uuid.New()
+
+	accessToken, err := utils.GenerateJWT(user.ID.String(), user.Role, sessionID.String(), "access")
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to generate access token: %v", err)
+	}
+	refreshToken, err := utils.GenerateJWT(user.ID.String(), user.Role, sessionID.String(), "refresh")
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to generate refresh token: %v", err)
+	}
+
+	// Save refresh token to sessions table
+	session := models.Session{
+		ID:           sessionID,
+		UserID:       user.ID,
+		RefreshToken: refreshToken,
+		FamilyID:     sessionID,
+		ExpiresAt:    time.Now().Add(utils.RefreshTokenTTL),
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
+	}
+	fillSessionDevice(c, app, &session)
+	_, err = app.DB.Model(&session).Insert()
+	if err != nil {
+		return "", "", fmt.Errorf("Failed to save session")
+	}
+
+	// Reading the login history and emailing must not hold up the sign-in, failures are logged
+	alerted := *user
+	go alertOnSuspiciousLogin(app, &alerted, &session)
+	return accessToken, refreshToken, nil
+}
+
+// PurgeExpiredSessions deletes the sessions whose login has expired, rotated ones included.
+// Rotated sessions of a live login are kept, they are needed to detect a reused refresh token.
+func PurgeExpiredSessions(ctx context.Context, app *config.App) (int, error) {
+	res, err := app.DB.ModelContext(ctx, (*models.Session)(nil)).
+		Where("expires_at < ?", time.Now()).
+		Delete()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// revokeSessionIDs deletes the given session rows and marks them revoked
+// so their outstanding access tokens stop working
+func revokeSessionIDs(ctx context.Context, app *config.App, ids []uuid.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	_, err := app.DB.Model((*models.Session)(nil)).
+		Where("id IN (?)", pg.In(ids)).
+		Delete()
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := utils.MarkSessionRevoked(ctx, app.Redis, id.String()); err != nil {
+			fmt.Printf("Warning: Failed to mark session %s as revoked: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+// revokeSessionFamily revokes the whole rotation chain the user's session belongs to.
+// It returns the number of revoked rows, 0 if the session does not exist.
+func revokeSessionFamily(ctx context.Context, app *config.App, userID string, sessionID string) (int, error) {
+	var session models.Session
+	err := app.DB.Model(&session).
+		Where("id = ? AND user_id = ?", sessionID, userID).
+		Select()
+	if err == pg.ErrNoRows {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var family []models.Session
+	err = app.DB.Model(&family).Column("id").Where("family_id = ?", session.FamilyID).Select()
+	if err != nil {
+		return 0, err
+	}
+
+	ids := make([]uuid.UUID, len(family))
+	for i, member := range family {
+		ids[i] = member.ID
+	}
+	if err := revokeSessionIDs(ctx, app, ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// revokeUserSessions revokes all sessions of the user except the rotation chain
+// of keepSessionID (may be empty)
+func revokeUserSessions(ctx context.Context, app *config.App, userID string, keepSessionID string) (int, error) {
+	var sessions []models.Session
+	query := app.DB.Model(&sessions).Column("id").Where("user_id = ?", userID)
+	if keepSessionID != "" {
+		query = query.Where("family_id NOT IN (SELECT family_id FROM franchiso.sessions WHERE id = ?)", keepSessionID)
+	}
+	if err := query.Select(); err != nil {
+		return 0, err
+	}
+
+	ids := make([]uuid.UUID, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.ID
+	}
+	if err := revokeSessionIDs(ctx, app, ids); err != nil {
+		return 0, err
+	}
+	return len(ids), nil
+}
+
+// RefreshToken exchanges a refresh token for a new access and refresh token pair.
+// Every refresh token can be used only once; presenting an already rotated token
+// again revokes the whole session family because the token has likely been stolen.
+func RefreshToken(c *gin.Context, app *config.App) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	refreshToken := req.RefreshToken
+	fromCookie := refreshToken == ""
+	if fromCookie {
+		refreshToken, _ = c.Cookie(middleware.RefreshTokenCookie)
+	}
+	if refreshToken == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token not found"})
+		return
+	}
+	if fromCookie && !middleware.CheckCSRF(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid CSRF token"})
+		return
+	}
+
+	claims, err := utils.ValidateJWT(refreshToken, "refresh")
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token"})
+		return
+	}
+
+	ctx := context.Background()
+	var session models.Session
+	err = app.DB.Model(&session).
+		Where("refresh_token = ? AND user_id = ?", refreshToken, claims.UserID).
+		Select()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		return
+	}
+
+	reuseDetected := func() {
+		if _, err := revokeSessionFamily(ctx, app, claims.UserID, session.ID.String()); err != nil {
+			fmt.Printf("Warning: Failed to revoke session family %s: %v\n", session.FamilyID, err)
+		}
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used. All sessions of this login have been revoked"})
+	}
+
+	if session.RotatedAt != nil {
+		reuseDetected()
+		return
+	}
+	if session.ExpiresAt.Before(time.Now()) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has expired"})
+		return
+	}
+
+	// Re-read the user so role changes are reflected in the new tokens
+	var user models.User
+	err = app.DB.Model(&user).Where("id = ?", session.UserID).Select()
+	if err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	// Mark the presented token as rotated; a concurrent request that already
+	// rotated it counts as reuse as well
+	now := time.Now()
+	res, err := app.DB.Model((*models.Session)(nil)).
+		Set("rotated_at = ?", now).
+		Set("updated_at = ?", now).
+		Where("id = ?", session.ID).
+		Where("rotated_at IS NULL").
+		Update()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate session"})
+		return
+	}
+	if res.RowsAffected() == 0 {
+		reuseDetected()
+		return
+	}
+
+	newSessionID := uuid.New()
+	newAccessToken, err := utils.GenerateJWT(user.ID.String(), user.Role, newSessionID.String(), "access")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate access token: %v", err)})
+		return
+	}
+	newRefreshToken, err := utils.GenerateJWT(user.ID.String(), user.Role, newSessionID.String(), "refresh")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to generate refresh token: %v", err)})
+		return
+	}
+
+	rotated := models.Session{
+		ID:           newSessionID,
+		UserID:       user.ID,
+		RefreshToken: newRefreshToken,
+		FamilyID:     session.FamilyID,
+		ParentID:     &session.ID,
+		ExpiresAt:    session.ExpiresAt, // the login expires as a whole, rotating does not extend it
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	fillSessionDevice(c, app, &rotated)
+	_, err = app.DB.Model(&rotated).Insert()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save session"})
+		return
+	}
+
+	// A refresh token read from the cookie is answered with new cookies
+	tokens, err := deliverTokens(c, app, fromCookie || isBrowserMode(c), newAccessToken, newRefreshToken)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set session cookies"})
+		return
+	}
+
+	c.JSON(http.StatusOK, RefreshTokenResponse{
+		AccessToken:  tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		CSRFToken:    tokens.CSRFToken,
+	})
+}
+
+// Logout signs out the current session and denylists the access token used for the request
+func Logout(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	sessionID := c.GetString("session_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	ctx := context.Background()
+	if sessionID != "" {
+		if _, err := revokeSessionFamily(ctx, app, userID, sessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+	}
+
+	if expiresAt, ok := c.Get("token_expires_at"); ok {
+		err := utils.DenylistToken(ctx, app.Redis, c.GetString("token_id"), expiresAt.(time.Time))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token"})
+			return
+		}
+	}
+
+	clearAuthCookies(c, app)
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+// ListSessions displays the active sessions of the current user
+func ListSessions(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	var sessions []models.Session
+	err := app.DB.Model(&sessions).
+		Where("user_id = ?", userID).
+		Where("rotated_at IS NULL").
+		Where("expires_at > ?", time.Now()).
+		Order("created_at DESC").
+		Select()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+		return
+	}
+
+	currentSessionID := c.GetString("session_id")
+	resp := ListSessionsResponse{Sessions: []SessionResponse{}}
+	for _, session := range sessions {
+		resp.Sessions = append(resp.Sessions, SessionResponse{
+			ID:         session.ID.String(),
+			Current:    session.ID.String() == currentSessionID,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			Country:    session.Country,
+			City:       session.City,
+			LastSeenAt: session.LastSeenAt,
+			CreatedAt:  session.CreatedAt,
+			ExpiresAt:  session.ExpiresAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, resp)
+}
+
+// RevokeSession signs out one of the current user's sessions, e.g. a lost device
+func RevokeSession(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	sessionID, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+		return
+	}
+
+	revoked, err := revokeSessionFamily(context.Background(), app, userID, sessionID.String())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	if revoked == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked successfully"})
+}
+
+// RevokeOtherSessions signs out every session of the current user except the one making the request
+func RevokeOtherSessions(c *gin.Context, app *config.App) {
+	userID := c.GetString("user_id")
+	if userID == "" {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User is not authenticated"})
+		return
+	}
+
+	revoked, err := revokeUserSessions(context.Background(), app, userID, c.GetString("session_id"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("Failed to revoke sessions: %v", err)})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Signed out from all other devices",
+		"revoked": revoked,
+	})
+}
@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/chrisprojs/Franchiso/config"
+	"github.com/chrisprojs/Franchiso/models"
+	"github.com/chrisprojs/Franchiso/utils"
+)
+
+// Devices and countries a user signed in from are remembered this long
+const knownLoginHistoryTTL = 180 * 24 * time.Hour
+
+// Version numbers are dropped from the user agent so browser updates don't look like a new device
+var userAgentVersion = regexp.MustCompile(`[0-9][0-9._]*`)
+
+type ReportSessionRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// sessionAlert is stored in Redis behind the "this wasn't me" link of an alert email
+type sessionAlert struct {
+	UserID      string `json:"user_id"`
+	FamilyID    string `json:"family_id"`
+	Fingerprint string `json:"fingerprint"`
+	Country     string `json:"country"`
+}
+
+func knownDevicesKey(userID string) string {
+	return fmt.Sprintf("known_devices:%s", userID)
+}
+
+func knownCountriesKey(userID string) string {
+	return fmt.Sprintf("known_countries:%s", userID)
+}
+
+func sessionAlertKey(tokenHash string) string {
+	return fmt.Sprintf("session_alert:%s", tokenHash)
+}
+
+func deviceFingerprint(userAgent string) string {
+	return utils.HashToken(strings.ToLower(userAgentVersion.ReplaceAllString(userAgent, "")))
+}
+
+// requestLocation reads the approximate location our proxy (Cloudflare or App Engine) adds to the request.
+// Without TRUST_GEO_HEADERS the headers may come from the client, so the location stays unknown.
+func requestLocation(c *gin.Context, app *config.App) (string, string) {
+	if !app.TrustGeoHeaders {
+		return "", ""
+	}
+	country := firstHeader(c, "CF-IPCountry", "X-Appengine-Country")
+	// XX is unknown, T1 is Tor
+	if country == "XX" || country == "T1" {
+		country = ""
+	}
+	city := firstHeader(c, "CF-IPCity", "X-Appengine-City")
+	return strings.ToUpper(country), city
+}
+
+func firstHeader(c *gin.Context, names ...string) string {
+	for _, name := range names {
+		if value := strings.TrimSpace(c.GetHeader(name)); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// fillSessionDevice records where the session is used from
+func fillSessionDevice(c *gin.Context, app *config.App, session *models.Session) {
+	session.UserAgent = c.Request.UserAgent()
+	session.IP = c.ClientIP()
+	session.Country, session.City = requestLocation(c, app)
+	session.LastSeenAt = time.Now()
+}
+
+// alertOnSuspiciousLogin remembers the session's device and country and emails the user
+// when either has not been seen before. The very first login is never reported.
+func alertOnSuspiciousLogin(app *config.App, user *models.User, session *models.Session) {
+	ctx := context.Background()
+	userID := user.ID.String()
+	fingerprint := deviceFingerprint(session.UserAgent)
+
+	pipe := app.Redis.TxPipeline()
+	devices := pipe.SMembers(ctx, knownDevicesKey(userID))
+	countries := pipe.SMembers(ctx, knownCountriesKey(userID))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		fmt.Printf("Warning: Failed to read login history of user %s: %v\n", userID, err)
+		return
+	}
+	firstLogin := len(devices.Val()) == 0
+	newDevice := !containsString(devices.Val(), fingerprint)
+	newCountry := session.Country != "" && len(countries.Val()) > 0 && !containsString(countries.Val(), session.Country)
+
+	pipe = app.Redis.TxPipeline()
+	pipe.SAdd(ctx, knownDevicesKey(userID), fingerprint)
+	pipe.Expire(ctx, knownDevicesKey(userID), knownLoginHistoryTTL)
+	if session.Country != "" {
+		pipe.SAdd(ctx, knownCountriesKey(userID), session.Country)
+		pipe.Expire(ctx, knownCountriesKey(userID), knownLoginHistoryTTL)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		fmt.Printf("Warning: Failed to update login history of user %s: %v\n", userID, err)
+	}
+
+	if firstLogin || (!newDevice && !newCountry) {
+		return
+	}
+
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return
+	}
+	alertJSON, err := json.Marshal(sessionAlert{
+		UserID:      userID,
+		FamilyID:    session.FamilyID.String(),
+		Fingerprint: fingerprint,
+		Country:     session.Country,
+	})
+	if err != nil {
+		return
+	}
+	// The link works as long as the session could be refreshed
+	err = app.Redis.Set(ctx, sessionAlertKey(utils.HashToken(token)), string(alertJSON), utils.RefreshTokenTTL).Err()
+	if err != nil {
+		fmt.Printf("Warning: Failed to store session alert of user %s: %v\n", userID, err)
+		return
+	}
+
+	reason := "a new device"
+	if newCountry {
+		reason = "a new country"
+	}
+	location := "Unknown location"
+	if session.Country != "" {
+		location = strings.TrimPrefix(fmt.Sprintf("%s, %s", session.City, session.Country), ", ")
+	}
+	reportLink := fmt.Sprintf("%s/session-alert?token=%s", app.Email.AppBaseURL, url.QueryEscape(token))
+	err = SendSuspiciousLoginEmail(app.Email, user.Email, user.Name, reason, session.UserAgent, session.IP, location, session.CreatedAt, reportLink)
+	if err != nil {
+		fmt.Printf("Warning: Failed to send login alert to %s: %v\n", user.Email, err)
+	}
+}
+
+// ReportSession is the "this wasn't me" link of a login alert, it signs the reported
+// session out and forgets its device and country
+func ReportSession(c *gin.Context, app *config.App) {
+	var req ReportSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx := context.Background()
+	alertJSON, err := app.Redis.GetDel(ctx, sessionAlertKey(utils.HashToken(req.Token))).Result()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Link is invalid or has already been used"})
+		return
+	}
+	var alert sessionAlert
+	if err := json.Unmarshal([]byte(alertJSON), &alert); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read login alert"})
+		return
+	}
+
+	if _, err := revokeSessionFamily(ctx, app, alert.UserID, alert.FamilyID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+		return
+	}
+	app.Redis.SRem(ctx, knownDevicesKey(alert.UserID), alert.Fingerprint)
+	if alert.Country != "" {
+		app.Redis.SRem(ctx, knownCountriesKey(alert.UserID), alert.Country)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "The session has been signed out. We recommend resetting your password"})
+}
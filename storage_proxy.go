@@ -1,6 +1,7 @@
 package main
 
 import (
+	"crypto/subtle"
 	"fmt"
 	"io"
 	"net/http"
@@ -66,6 +67,43 @@ func RunStorageProxy() {
 		c.JSON(http.StatusOK, gin.H{"fileUrl": url})
 	})
 
+	// List every stored file, used by purge_orphaned_uploads. The listing would reveal the
+	// names of private documents, so it needs the STORAGE_PROXY_SECRET shared with the CLI.
+	listSecret := os.Getenv("STORAGE_PROXY_SECRET")
+	r.GET("/files", func(c *gin.Context) {
+		if listSecret == "" {
+			c.JSON(http.StatusForbidden, gin.H{"error": "File listing is disabled, set STORAGE_PROXY_SECRET"})
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("X-Storage-Secret")), []byte(listSecret)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid storage secret"})
+			return
+		}
+
+		entries, err := os.ReadDir(uploadDir)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list files"})
+			return
+		}
+
+		files := []gin.H{}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				continue // removed while listing
+			}
+			files = append(files, gin.H{
+				"fileUrl":    fmt.Sprintf("/file/%s", entry.Name()),
+				"size":       info.Size(),
+				"modifiedAt": info.ModTime(),
+			})
+		}
+		c.JSON(http.StatusOK, gin.H{"files": files})
+	})
+
 	r.GET("/file/:filename", func(c *gin.Context) {
 		fmt.Println("filename", c.Param("filename"))
 		filename := c.Param("filename")
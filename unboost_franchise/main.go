@@ -52,6 +52,7 @@ func checkAndRemoveExpiredBoosts(db *pg.DB, es *elastic.Client) error {
 		var franchise models.Franchise
 		err := db.Model(&franchise).
 			Where("id = ?", boost.FranchiseID).
+			AllWithDeleted().
 			Select()
 
 		if err != nil {
@@ -66,11 +67,13 @@ func checkAndRemoveExpiredBoosts(db *pg.DB, es *elastic.Client) error {
 			continue
 		}
 
-		// Update franchise is_boosted to false in Elasticsearch
-		err = updateFranchiseBoostStatusES(es, franchise.ID.String(), false)
-		if err != nil {
-			log.Printf("Error updating franchise boost status in Elasticsearch for %s: %v", franchise.ID, err)
-			continue
+		// Update franchise is_boosted to false in Elasticsearch, archived franchises are not indexed
+		if franchise.DeletedAt == nil {
+			err = updateFranchiseBoostStatusES(es, franchise.ID.String(), false)
+			if err != nil {
+				log.Printf("Error updating franchise boost status in Elasticsearch for %s: %v", franchise.ID, err)
+				continue
+			}
 		}
 
 		// Delete the expired boost
@@ -91,6 +94,7 @@ func updateFranchiseBoostStatus(db *pg.DB, franchiseID uuid.UUID, isBoosted bool
 		Set("is_boosted = ?", isBoosted).
 		Set("updated_at = ?", time.Now()).
 		Where("id = ?", franchiseID).
+		AllWithDeleted().
 		Update()
 
 	return err
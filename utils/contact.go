@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	phoneSeparators  = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "")
+	e164Digits       = regexp.MustCompile(`^[1-9][0-9]{7,14}$`)
+	indonesianMobile = regexp.MustCompile(`^628[1-9][0-9]{7,10}$`)
+)
+
+// NormalizeWhatsappNumber returns the number in E.164 form. Numbers without a country code
+// are Indonesian, so 0812-3456-789, 628123456789 and +62 812 3456 789 all become +628123456789.
+func NormalizeWhatsappNumber(raw string) (string, error) {
+	number := phoneSeparators.Replace(strings.TrimSpace(raw))
+	switch {
+	case strings.HasPrefix(number, "+"):
+		number = number[1:]
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case strings.HasPrefix(number, "0"):
+		number = "62" + number[1:]
+	case strings.HasPrefix(number, "8"):
+		number = "62" + number
+	}
+	if !e164Digits.MatchString(number) {
+		return "", errors.New("Enter a phone number like 0812-3456-7890 or +62 812 3456 7890")
+	}
+	if strings.HasPrefix(number, "62") && !indonesianMobile.MatchString(number) {
+		return "", errors.New("Enter an Indonesian mobile number, they start with 08 or +62 8")
+	}
+	return "+" + number, nil
+}
+
+// NormalizeWebsiteURL checks the syntax of a website address and returns it with a scheme,
+// example.com becomes https://example.com
+func NormalizeWebsiteURL(raw string) (string, error) {
+	value := strings.TrimSpace(raw)
+	if !strings.Contains(value, "://") {
+		value = "https://" + value
+	}
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return "", errors.New("Enter a valid website address")
+	}
+	if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return "", errors.New("The website must start with http:// or https://")
+	}
+	host := strings.ToLower(parsed.Hostname())
+	if parsed.User != nil || !strings.Contains(host, ".") || strings.HasPrefix(host, ".") || strings.HasSuffix(host, ".") || strings.Contains(host, "..") {
+		return "", errors.New("Enter a website address with a domain, like example.com")
+	}
+	parsed.Host = strings.ToLower(parsed.Host)
+	return parsed.String(), nil
+}
@@ -2,28 +2,40 @@ package utils
 
 import (
 	"errors"
-	"os"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
-var jwtSecret = []byte(os.Getenv("JWT_SECRET"))
+const (
+	AccessTokenTTL     = 180 * time.Minute
+	RefreshTokenTTL    = 7 * 24 * time.Hour
+	MFAPendingTokenTTL = 5 * time.Minute
+	EmailLoginTokenTTL = 15 * time.Minute
+)
 
 type JWTClaims struct {
 	UserID    string `json:"user_id"`
 	Role      string `json:"role"`
-	TokenType string `json:"token_type"` // "access" or "refresh"
+	SessionID string `json:"session_id"`
+	TokenType string `json:"token_type"` // "access", "refresh", "mfa_pending" or "email_login"
 	jwt.RegisteredClaims
 }
 
 // generate JWT function for access or refresh token
-func GenerateJWT(userID, role, tokenType string) (string, error) {
+func GenerateJWT(userID, role, sessionID, tokenType string) (string, error) {
 	var expiresAt time.Time
 	if tokenType == "access" {
-		expiresAt = time.Now().Add(180 * time.Minute) // access token 15 minutes
+		expiresAt = time.Now().Add(AccessTokenTTL)
 	} else if tokenType == "refresh" {
-		expiresAt = time.Now().Add(7 * 24 * time.Hour) // refresh token 7 days
+		expiresAt = time.Now().Add(RefreshTokenTTL)
+	} else if tokenType == "mfa_pending" {
+		// password was correct, the second factor is still missing
+		expiresAt = time.Now().Add(MFAPendingTokenTTL)
+	} else if tokenType == "email_login" {
+		// passwordless login link, single use is enforced through Redis
+		expiresAt = time.Now().Add(EmailLoginTokenTTL)
 	} else {
 		return "", errors.New("invalid token type")
 	}
@@ -31,21 +43,28 @@ func GenerateJWT(userID, role, tokenType string) (string, error) {
 	claims := JWTClaims{
 		UserID:    userID,
 		Role:      role,
+		SessionID: sessionID,
 		TokenType: tokenType,
 		RegisteredClaims: jwt.RegisteredClaims{
+			// jti is used to denylist a single token before it expires
+			ID:        uuid.New().String(),
 			ExpiresAt: jwt.NewNumericDate(expiresAt),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(jwtSecret)
+	ring, err := getKeyring()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(ring.signing.Method, claims)
+	// kid tells verifiers which key of the JWKS signed the token
+	token.Header["kid"] = ring.signing.ID
+	return token.SignedString(ring.signing.Private)
 }
 
 // validasi JWT function to check token type
 func ValidateJWT(tokenString, expectedType string) (*JWTClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return jwtSecret, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &JWTClaims{}, jwtKeyfunc)
 	if err != nil {
 		return nil, err
 	}
@@ -0,0 +1,299 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// jwtKey is a key tokens can be verified with, signing additionally needs the private part
+type jwtKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	PublicKey crypto.PublicKey
+	Private   crypto.Signer
+}
+
+type jwtKeyring struct {
+	signing      *jwtKey
+	verification map[string]*jwtKey
+	legacySecret []byte    // HS256 secret still accepted for tokens issued before the switch
+	legacyUntil  time.Time // the legacy secret is no longer accepted after this moment
+}
+
+var (
+	keyring     *jwtKeyring
+	keyringErr  error
+	keyringOnce sync.Once
+)
+
+// LoadJWTKeys reads the signing and verification keys from the environment:
+//   - JWT_SIGNING_KEY_PATH: PEM private key (RSA or Ed25519) new tokens are signed with
+//   - JWT_SIGNING_KEY_ID: its kid, derived from the public key when empty
+//   - JWT_VERIFICATION_KEYS_PATH: directory of <kid>.pem public keys that are still accepted,
+//     e.g. the previous signing key while its tokens expire
+//   - JWT_SECRET: legacy HS256 secret, only used to verify tokens without a kid
+//   - JWT_LEGACY_ACCEPT_UNTIL: RFC 3339 time after which JWT_SECRET is no longer accepted,
+//     at most one refresh token lifetime away. Without it JWT_SECRET is ignored.
+//
+// Without JWT_SIGNING_KEY_PATH loading fails, unless JWT_EPHEMERAL_KEY=true allows an
+// ephemeral Ed25519 key. Its tokens do not survive a restart, it is only meant for local development.
+func LoadJWTKeys() error {
+	keyringOnce.Do(func() {
+		keyring, keyringErr = loadJWTKeyring()
+	})
+	return keyringErr
+}
+
+func getKeyring() (*jwtKeyring, error) {
+	if err := LoadJWTKeys(); err != nil {
+		return nil, err
+	}
+	return keyring, nil
+}
+
+func loadJWTKeyring() (*jwtKeyring, error) {
+	ring := &jwtKeyring{verification: map[string]*jwtKey{}}
+	if secret := os.Getenv("JWT_SECRET"); secret != "" {
+		if err := ring.loadLegacySecret(secret, os.Getenv("JWT_LEGACY_ACCEPT_UNTIL")); err != nil {
+			return nil, err
+		}
+	}
+
+	signingPath := os.Getenv("JWT_SIGNING_KEY_PATH")
+	if signingPath == "" {
+		if os.Getenv("JWT_EPHEMERAL_KEY") != "true" {
+			return nil, errors.New("JWT_SIGNING_KEY_PATH is not set, set JWT_EPHEMERAL_KEY=true to use a throwaway key in local development")
+		}
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key, err := newJWTKey("", private)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("Warning: JWT_EPHEMERAL_KEY is set, signing tokens with an ephemeral key")
+		ring.signing = key
+	} else {
+		data, err := os.ReadFile(signingPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWT signing key: %v", err)
+		}
+		private, err := parsePrivateKeyPEM(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse JWT signing key: %v", err)
+		}
+		key, err := newJWTKey(os.Getenv("JWT_SIGNING_KEY_ID"), private)
+		if err != nil {
+			return nil, err
+		}
+		ring.signing = key
+	}
+	ring.verification[ring.signing.ID] = ring.signing
+
+	if dir := os.Getenv("JWT_VERIFICATION_KEYS_PATH"); dir != "" {
+		paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+		if err != nil {
+			return nil, err
+		}
+		for _, path := range paths {
+			kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+			if _, exists := ring.verification[kid]; exists {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read JWT verification key %s: %v", kid, err)
+			}
+			public, err := parsePublicKeyPEM(data)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse JWT verification key %s: %v", kid, err)
+			}
+			method, err := signingMethodFor(public)
+			if err != nil {
+				return nil, fmt.Errorf("JWT verification key %s: %v", kid, err)
+			}
+			ring.verification[kid] = &jwtKey{ID: kid, Method: method, PublicKey: public}
+		}
+	}
+
+	return ring, nil
+}
+
+func newJWTKey(kid string, private crypto.Signer) (*jwtKey, error) {
+	method, err := signingMethodFor(private.Public())
+	if err != nil {
+		return nil, err
+	}
+	if kid == "" {
+		der, err := x509.MarshalPKIXPublicKey(private.Public())
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(der)
+		kid = hex.EncodeToString(sum[:8])
+	}
+	return &jwtKey{ID: kid, Method: method, PublicKey: private.Public(), Private: private}, nil
+}
+
+func signingMethodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch public.(type) {
+	case *rsa.PublicKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, errors.New("unsupported key type, use RSA or Ed25519")
+	}
+}
+
+func parsePrivateKeyPEM(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported private key")
+	}
+	return signer, nil
+}
+
+func parsePublicKeyPEM(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type == "PUBLIC KEY" {
+		return x509.ParsePKIXPublicKey(block.Bytes)
+	}
+	// A private key file is accepted as well, only its public part is kept
+	private, err := parsePrivateKeyPEM(data)
+	if err != nil {
+		return nil, err
+	}
+	return private.Public(), nil
+}
+
+// loadLegacySecret accepts the HS256 secret until the given time, which may not be further away
+// than the lifetime of the last refresh tokens signed with it
+func (ring *jwtKeyring) loadLegacySecret(secret, until string) error {
+	if until == "" {
+		fmt.Println("Warning: JWT_SECRET is ignored without JWT_LEGACY_ACCEPT_UNTIL")
+		return nil
+	}
+	deadline, err := time.Parse(time.RFC3339, until)
+	if err != nil {
+		return fmt.Errorf("invalid JWT_LEGACY_ACCEPT_UNTIL: %v", err)
+	}
+	if time.Until(deadline) > RefreshTokenTTL {
+		return fmt.Errorf("JWT_LEGACY_ACCEPT_UNTIL must be within %s, the refresh token lifetime", RefreshTokenTTL)
+	}
+	if !time.Now().Before(deadline) {
+		fmt.Println("Warning: JWT_LEGACY_ACCEPT_UNTIL has passed, JWT_SECRET can be removed")
+		return nil
+	}
+	ring.legacySecret = []byte(secret)
+	ring.legacyUntil = deadline
+	return nil
+}
+
+// acceptsLegacy reports whether the token may still be verified with the legacy secret:
+// an HS256 token issued before the deadline, presented before the deadline
+func (ring *jwtKeyring) acceptsLegacy(token *jwt.Token) bool {
+	if ring.legacySecret == nil || token.Method != jwt.SigningMethodHS256 || !time.Now().Before(ring.legacyUntil) {
+		return false
+	}
+	issuedAt, err := token.Claims.GetIssuedAt()
+	return err == nil && issuedAt != nil && issuedAt.Before(ring.legacyUntil)
+}
+
+// jwtKeyfunc picks the verification key by the token's kid and checks the algorithm matches it
+func jwtKeyfunc(token *jwt.Token) (interface{}, error) {
+	ring, err := getKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if ring.acceptsLegacy(token) {
+			return ring.legacySecret, nil
+		}
+		return nil, errors.New("token has no kid")
+	}
+
+	key, ok := ring.verification[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown kid %q", kid)
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.PublicKey, nil
+}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns every key tokens are currently verified with
+func PublicJWKS() (JWKSet, error) {
+	ring, err := getKeyring()
+	if err != nil {
+		return JWKSet{}, err
+	}
+
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range ring.verification {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Method.Alg()}
+		switch public := key.PublicKey.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set, nil
+}
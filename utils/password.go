@@ -0,0 +1,147 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// PasswordHasher is one password hashing algorithm. Every hash it produces starts
+// with the algorithm identifier, so stored hashes of several algorithms can coexist.
+type PasswordHasher interface {
+	// Matches reports whether the encoded hash was produced by this algorithm
+	Matches(encoded string) bool
+	Hash(password string) (string, error)
+	Verify(encoded, password string) (bool, error)
+	// NeedsRehash reports whether the hash was made with weaker parameters than the current ones
+	NeedsRehash(encoded string) bool
+}
+
+// argon2idHasher encodes hashes in the PHC format: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+type argon2idHasher struct {
+	memory  uint32 // KiB
+	time    uint32
+	threads uint8
+	saltLen int
+	keyLen  uint32
+}
+
+// bcryptHasher is only kept to verify hashes created before the switch to argon2id
+type bcryptHasher struct{}
+
+var (
+	// DefaultPasswordHasher is used for every new hash
+	DefaultPasswordHasher PasswordHasher = argon2idHasher{memory: 64 * 1024, time: 3, threads: 2, saltLen: 16, keyLen: 32}
+
+	passwordHashers = []PasswordHasher{DefaultPasswordHasher, bcryptHasher{}}
+
+	ErrUnknownPasswordHash = errors.New("unknown password hash algorithm")
+)
+
+// HashPassword hashes a password with the default algorithm
+func HashPassword(password string) (string, error) {
+	return DefaultPasswordHasher.Hash(password)
+}
+
+// VerifyPassword checks a password against a stored hash of any supported algorithm.
+// needsRehash is true when the password is correct but the hash should be replaced
+// with one of the default algorithm.
+func VerifyPassword(encoded, password string) (ok bool, needsRehash bool, err error) {
+	for _, hasher := range passwordHashers {
+		if !hasher.Matches(encoded) {
+			continue
+		}
+		ok, err := hasher.Verify(encoded, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+		return true, hasher != DefaultPasswordHasher || hasher.NeedsRehash(encoded), nil
+	}
+	return false, false, ErrUnknownPasswordHash
+}
+
+func (h argon2idHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$argon2id$")
+}
+
+func (h argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.saltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, h.time, h.memory, h.threads, h.keyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.memory, h.time, h.threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h argon2idHasher) Verify(encoded, password string) (bool, error) {
+	params, salt, key, err := h.decode(encoded)
+	if err != nil {
+		return false, err
+	}
+	computed := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+	return subtle.ConstantTimeCompare(key, computed) == 1, nil
+}
+
+func (h argon2idHasher) NeedsRehash(encoded string) bool {
+	params, _, key, err := h.decode(encoded)
+	if err != nil {
+		return true
+	}
+	return params.memory < h.memory || params.time < h.time || params.threads < h.threads || uint32(len(key)) < h.keyLen
+}
+
+func (h argon2idHasher) decode(encoded string) (argon2idHasher, []byte, []byte, error) {
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return argon2idHasher{}, nil, nil, errors.New("invalid argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return argon2idHasher{}, nil, nil, errors.New("unsupported argon2id version")
+	}
+	var params argon2idHasher
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return argon2idHasher{}, nil, nil, errors.New("invalid argon2id parameters")
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return argon2idHasher{}, nil, nil, err
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return argon2idHasher{}, nil, nil, err
+	}
+	return params, salt, key, nil
+}
+
+func (bcryptHasher) Matches(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	return string(hash), err
+}
+
+func (bcryptHasher) Verify(encoded, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if err == bcrypt.ErrMismatchedHashAndPassword {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (bcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < bcrypt.DefaultCost
+}
@@ -0,0 +1,72 @@
+package utils
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/chrisprojs/Franchiso/config"
+)
+
+// FieldError describes why one request field was rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+//go:embed common_passwords.txt
+var commonPasswordsFile string
+
+var (
+	commonPasswords     map[string]struct{}
+	commonPasswordsOnce sync.Once
+)
+
+func isCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(func() {
+		commonPasswords = map[string]struct{}{}
+		scanner := bufio.NewScanner(strings.NewReader(commonPasswordsFile))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			commonPasswords[strings.ToLower(line)] = struct{}{}
+		}
+	})
+	_, found := commonPasswords[strings.ToLower(password)]
+	return found
+}
+
+// CheckPasswordPolicy returns every rule of the policy the password breaks, reported on field.
+// email and name are the account's, the password may not contain them.
+func CheckPasswordPolicy(policy *config.PasswordPolicyConfig, field, password, email, name string) []FieldError {
+	errs := []FieldError{}
+	length := utf8.RuneCountInString(password)
+	if length < policy.MinLength {
+		errs = append(errs, FieldError{Field: field, Code: "too_short", Message: fmt.Sprintf("Password must be at least %d characters", policy.MinLength)})
+	}
+	if policy.MaxLength > 0 && length > policy.MaxLength {
+		errs = append(errs, FieldError{Field: field, Code: "too_long", Message: fmt.Sprintf("Password must be at most %d characters", policy.MaxLength)})
+	}
+	if policy.RejectCommon && isCommonPassword(password) {
+		errs = append(errs, FieldError{Field: field, Code: "too_common", Message: "Password is too common, choose a less predictable one"})
+	}
+
+	lowered := strings.ToLower(password)
+	localPart := strings.ToLower(strings.SplitN(email, "@", 2)[0])
+	if len(localPart) >= 3 && strings.Contains(lowered, localPart) {
+		errs = append(errs, FieldError{Field: field, Code: "contains_email", Message: "Password must not contain your email address"})
+	}
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		if utf8.RuneCountInString(word) >= 3 && strings.Contains(lowered, word) {
+			errs = append(errs, FieldError{Field: field, Code: "contains_name", Message: "Password must not contain your name"})
+			break
+		}
+	}
+	return errs
+}
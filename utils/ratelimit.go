@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+// RecordAttempt adds an attempt to a sliding window kept in a Redis sorted set
+// and returns how many attempts happened within the window, this one included.
+func RecordAttempt(ctx context.Context, client *redis.Client, key string, window time.Duration) (int64, error) {
+	now := time.Now()
+	pipe := client.TxPipeline()
+	pipe.ZRemRangeByScore(ctx, key, "-inf", fmt.Sprintf("%d", now.Add(-window).UnixNano()))
+	pipe.ZAdd(ctx, key, redis.Z{Score: float64(now.UnixNano()), Member: uuid.New().String()})
+	count := pipe.ZCard(ctx, key)
+	pipe.Expire(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+	return count.Val(), nil
+}
+
+// CountAttempts returns the number of attempts within the sliding window without recording one
+func CountAttempts(ctx context.Context, client *redis.Client, key string, window time.Duration) (int64, error) {
+	min := fmt.Sprintf("%d", time.Now().Add(-window).UnixNano())
+	return client.ZCount(ctx, key, min, "+inf").Result()
+}
+
+// ProgressiveDelay doubles the delay for every failure past the first, up to max
+func ProgressiveDelay(failures int64, base, max time.Duration) time.Duration {
+	if failures <= 0 {
+		return 0
+	}
+	delay := base
+	for i := int64(1); i < failures; i++ {
+		delay *= 2
+		if delay >= max {
+			return max
+		}
+	}
+	return delay
+}
+
+// IncrementDailyUsage counts a request against a quota that resets at midnight UTC.
+// It returns the count of the current day, this request included, and the time left until the reset.
+func IncrementDailyUsage(ctx context.Context, client *redis.Client, prefix string) (int64, time.Duration, error) {
+	now := time.Now().UTC()
+	resetAt := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+	key := fmt.Sprintf("%s:%s", prefix, now.Format("20060102"))
+
+	pipe := client.TxPipeline()
+	count := pipe.Incr(ctx, key)
+	pipe.ExpireAt(ctx, key, resetAt)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, 0, err
+	}
+	return count.Val(), resetAt.Sub(now), nil
+}
@@ -10,8 +10,10 @@ import (
 	"io"
 	"mime/multipart"
 	"net/http"
+	"os"
 	"strings"
 	"path/filepath"
+	"time"
 
 	"github.com/disintegration/imaging"
 )
@@ -56,13 +58,52 @@ func UploadToStorageProxy(fileHeader *multipart.FileHeader) (string, error) {
 	return result.FileUrl, nil
 }
 
+// StoredFile is one file kept by the storage proxy
+type StoredFile struct {
+	FileUrl    string    `json:"fileUrl"`
+	Size       int64     `json:"size"`
+	ModifiedAt time.Time `json:"modifiedAt"`
+}
+
+// ListStorageProxyFiles returns every file kept by the storage proxy
+func ListStorageProxyFiles() ([]StoredFile, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://localhost:8081/files", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Storage-Secret", os.Getenv("STORAGE_PROXY_SECRET"))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("failed to list files (%d): %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		Files []StoredFile `json:"files"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return result.Files, nil
+}
+
+// StorageFileName returns the stored file name of a file URL or filename,
+// e.g. "abc123.jpg" for "/file/abc123.jpg" or "http://localhost:8081/file/abc123.jpg"
+func StorageFileName(fileURL string) string {
+	parts := strings.Split(fileURL, "/")
+	return parts[len(parts)-1]
+}
+
 // DeleteFromStorageProxy deletes a file from storage proxy by file URL or filename
 func DeleteFromStorageProxy(fileURL string) error {
-	// fileURL example: "/file/abc123.jpg" or "http://localhost:8081/file/abc123.jpg"
-
 	// Normalize filename
-	parts := strings.Split(fileURL, "/")
-	filename := parts[len(parts)-1]
+	filename := StorageFileName(fileURL)
 
 	if filename == "" {
 		return fmt.Errorf("invalid filename")
@@ -0,0 +1,36 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// DenylistToken stores a token's jti in Redis until the token itself expires
+func DenylistToken(ctx context.Context, client *redis.Client, jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return client.Set(ctx, fmt.Sprintf("token_denylist:%s", jti), "1", ttl).Err()
+}
+
+// IsTokenDenylisted reports whether the token with the given jti has been revoked
+func IsTokenDenylisted(ctx context.Context, client *redis.Client, jti string) bool {
+	exists, err := client.Exists(ctx, fmt.Sprintf("token_denylist:%s", jti)).Result()
+	return err == nil && exists > 0
+}
+
+// MarkSessionRevoked rejects every access token issued for the session.
+// The marker only has to outlive the longest possible access token.
+func MarkSessionRevoked(ctx context.Context, client *redis.Client, sessionID string) error {
+	return client.Set(ctx, fmt.Sprintf("revoked_session:%s", sessionID), "1", AccessTokenTTL).Err()
+}
+
+// IsSessionRevoked reports whether the session has been signed out
+func IsSessionRevoked(ctx context.Context, client *redis.Client, sessionID string) bool {
+	exists, err := client.Exists(ctx, fmt.Sprintf("revoked_session:%s", sessionID)).Result()
+	return err == nil && exists > 0
+}
@@ -2,6 +2,7 @@ package utils
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -13,3 +14,18 @@ func GenerateVerificationCode() (string, error) {
 	}
 	return hex.EncodeToString(bytes)[:6], nil
 }
+
+// GenerateSecureToken generates a random hex token for links and API credentials
+func GenerateSecureToken(byteLength int) (string, error) {
+	bytes := make([]byte, byteLength)
+	if _, err := rand.Read(bytes); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(bytes), nil
+}
+
+// HashToken returns the SHA-256 hex digest stored instead of the raw token
+func HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}